@@ -1,16 +1,275 @@
 package main
 
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
 const (
-	// AttrNoStrLen applies to functions and indicates that they have string
-	// parameter(s) without corresponding length parameter(s).
+	// AttrDeprecated applies to enums and functions and marks the generated
+	// Go declarations deprecated with the given message, which takes
+	// precedence over deprecation markers in the header.
+	AttrDeprecated = "deprecated"
+	// AttrEndFrame applies to functions which end a frame, such as nk_clear,
+	// and makes the nesting checks generated with -nkdebug verify that no
+	// begin/end scopes are open when they are called.
+	AttrEndFrame = "endframe"
+	// AttrName applies to enums and functions and overrides the name of the
+	// generated Go type or function.
+	AttrName = "name"
+	// AttrNoStrLen applies to functions and parameters and indicates that
+	// string parameter(s) are not followed by corresponding length
+	// parameter(s).
 	AttrNoStrLen = "nostrlen"
-	// AttrUnsafePtr applies to functions and indicates that they take pointer
-	// parameters which must be cast through unsafe.Pointer. For example, Go
-	// will not allow *uintptr to be cast to *C.size_t even though they are
-	// equivalent in size. This is not necessary for struct types, since it
-	// is assumed they can't be cast directly anyway.
+	// AttrOut applies to parameters and indicates that the pointer parameter
+	// is only written by the function, so its pointee is returned from the Go
+	// function instead of being taken as a parameter.
+	AttrOut = "out"
+	// AttrPair applies to functions which begin a block, such as nk_begin,
+	// and names the C function which ends it. A closure-style helper is then
+	// generated which calls the begin function, the closure and the end
+	// function; if the begin function returns bool, the closure and the end
+	// function are only called if it returns true.
+	AttrPair = "pair"
+	// AttrPairAlways applies to functions with AttrPair and indicates that
+	// the end function must be called even if the begin function returns
+	// false, as nk_end must be after nk_begin.
+	AttrPairAlways = "pairalways"
+	// AttrPairName applies to functions with AttrPair and sets the name of
+	// the helper, which is otherwise the Go name of the begin function
+	// without "Begin".
+	AttrPairName = "pairname"
+	// AttrParamPrefix is the prefix of attributes which set parameter
+	// attributes on a single parameter of a function, identified by its C
+	// name or 0-based index, e.g. param.title=nostrlen or param.2=out|unsafeptr.
+	AttrParamPrefix = "param."
+	// AttrUnsafePtr applies to functions and parameters and indicates that
+	// they take pointer parameters which must be cast through
+	// unsafe.Pointer. For example, Go will not allow *uintptr to be cast to
+	// *C.size_t even though they are equivalent in size. This is not
+	// necessary for struct types, since it is assumed they can't be cast
+	// directly anyway.
 	AttrUnsafePtr = "unsafeptr"
 	// AttrUntyped applies to enums and indicates that their constants should
 	// be untyped.
 	AttrUntyped = "untyped"
 )
+
+// AttrValueType describes the value an attribute takes.
+type AttrValueType int
+
+const (
+	// AttrValueNone means the attribute is a flag and takes no value.
+	AttrValueNone AttrValueType = iota
+	// AttrValueIdent means the value must be a Go identifier.
+	AttrValueIdent
+	// AttrValueString means the value may be any non-empty text.
+	AttrValueString
+	// AttrValueParamAttrs means the value is a list of parameter attributes
+	// separated by |.
+	AttrValueParamAttrs
+)
+
+func (t AttrValueType) String() string {
+	switch t {
+	case AttrValueNone:
+		return "none"
+	case AttrValueIdent:
+		return "identifier"
+	case AttrValueString:
+		return "string"
+	case AttrValueParamAttrs:
+		return "parameter attributes"
+	}
+	return fmt.Sprintf("AttrValueType(%d)", int(t))
+}
+
+// AttrSpec describes an attribute which may be set in pattern files.
+type AttrSpec struct {
+	Name      string
+	AppliesTo []DeclKind
+	Value     AttrValueType
+	Doc       string
+}
+
+// attrRegistry lists every known attribute.
+var attrRegistry = []AttrSpec{
+	{
+		Name:      AttrDeprecated,
+		AppliesTo: []DeclKind{DeclEnum, DeclFunc},
+		Value:     AttrValueString,
+		Doc:       "marks the Go type and constants or function deprecated with the given message, which must be quoted like a Go string to contain commas",
+	},
+	{
+		Name:      AttrEndFrame,
+		AppliesTo: []DeclKind{DeclFunc},
+		Value:     AttrValueNone,
+		Doc:       "function ends a frame, so no begin/end scopes may be open (checked with -nkdebug)",
+	},
+	{
+		Name:      AttrName,
+		AppliesTo: []DeclKind{DeclEnum, DeclFunc},
+		Value:     AttrValueIdent,
+		Doc:       "overrides the name of the generated Go type or function",
+	},
+	{
+		Name:      AttrNoStrLen,
+		AppliesTo: []DeclKind{DeclFunc, DeclParam},
+		Value:     AttrValueNone,
+		Doc:       "string parameters are not followed by length parameters",
+	},
+	{
+		Name:      AttrOut,
+		AppliesTo: []DeclKind{DeclParam},
+		Value:     AttrValueNone,
+		Doc:       "pointer parameter is returned instead of taken as a parameter",
+	},
+	{
+		Name:      AttrPair,
+		AppliesTo: []DeclKind{DeclFunc},
+		Value:     AttrValueIdent,
+		Doc:       "names the C function ending the block begun by the function, generating a closure-style helper",
+	},
+	{
+		Name:      AttrPairAlways,
+		AppliesTo: []DeclKind{DeclFunc},
+		Value:     AttrValueNone,
+		Doc:       "helper calls the end function even if the begin function returns false",
+	},
+	{
+		Name:      AttrPairName,
+		AppliesTo: []DeclKind{DeclFunc},
+		Value:     AttrValueIdent,
+		Doc:       "overrides the name of the helper generated for pair",
+	},
+	{
+		Name:      AttrParamPrefix + "<name|index>",
+		AppliesTo: []DeclKind{DeclFunc},
+		Value:     AttrValueParamAttrs,
+		Doc:       "sets parameter attributes, separated by |, on a parameter given by C name or 0-based index",
+	},
+	{
+		Name:      AttrUnsafePtr,
+		AppliesTo: []DeclKind{DeclFunc, DeclParam},
+		Value:     AttrValueNone,
+		Doc:       "pointer parameters are cast through unsafe.Pointer",
+	},
+	{
+		Name:      AttrUntyped,
+		AppliesTo: []DeclKind{DeclEnum},
+		Value:     AttrValueNone,
+		Doc:       "constants are untyped",
+	},
+}
+
+var (
+	identRegexp      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	paramIndexRegexp = regexp.MustCompile(`^[0-9]+$`)
+)
+
+func lookupAttr(name string) (AttrSpec, bool) {
+	if strings.HasPrefix(name, AttrParamPrefix) {
+		name = AttrParamPrefix + "<name|index>"
+	}
+	for _, spec := range attrRegistry {
+		if spec.Name == name {
+			return spec, true
+		}
+	}
+	return AttrSpec{}, false
+}
+
+// validateAttr returns an error if the attribute is unknown, does not apply
+// to declarations of the given kind, or has an invalid value.
+func validateAttr(kind DeclKind, key, value string) error {
+	spec, ok := lookupAttr(key)
+	if !ok {
+		return fmt.Errorf("unknown attribute %s", key)
+	}
+	applies := false
+	for _, appliesTo := range spec.AppliesTo {
+		if appliesTo == kind {
+			applies = true
+		}
+	}
+	if !applies {
+		return fmt.Errorf("attribute %s does not apply to %ss", key, kind)
+	}
+	switch spec.Value {
+	case AttrValueNone:
+		if value != "" {
+			return fmt.Errorf("attribute %s takes no value", key)
+		}
+	case AttrValueIdent:
+		if !identRegexp.MatchString(value) {
+			return fmt.Errorf("attribute %s requires an identifier value, got '%s'", key, value)
+		}
+	case AttrValueString:
+		if value == "" {
+			return fmt.Errorf("attribute %s requires a value", key)
+		}
+	case AttrValueParamAttrs:
+		if selector := strings.TrimPrefix(key, AttrParamPrefix); !identRegexp.MatchString(selector) &&
+			!paramIndexRegexp.MatchString(selector) {
+			return fmt.Errorf("attribute %s must name a parameter by identifier or index", key)
+		}
+		if value == "" {
+			return fmt.Errorf("attribute %s requires a value", key)
+		}
+		for _, paramAttr := range strings.Split(value, "|") {
+			if err := validateAttr(DeclParam, paramAttr, ""); err != nil {
+				return fmt.Errorf("in value of attribute %s: %w", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveParamAttrs returns the parameter attributes set on f through
+// AttrParamPrefix attributes, indexed by C parameter index.
+func resolveParamAttrs(f FunctionDecl) ([]map[string]bool, error) {
+	paramAttrs := make([]map[string]bool, len(f.Params))
+	for key, value := range f.Attrs {
+		if !strings.HasPrefix(key, AttrParamPrefix) {
+			continue
+		}
+		selector := strings.TrimPrefix(key, AttrParamPrefix)
+		index := -1
+		if paramIndexRegexp.MatchString(selector) {
+			index, _ = strconv.Atoi(selector)
+		} else {
+			for i, param := range f.Params {
+				if param.Name == selector {
+					index = i
+				}
+			}
+		}
+		if index < 0 || index >= len(f.Params) {
+			return nil, fmt.Errorf("attribute %s does not name a parameter", key)
+		}
+		if paramAttrs[index] == nil {
+			paramAttrs[index] = make(map[string]bool)
+		}
+		for _, paramAttr := range strings.Split(value, "|") {
+			paramAttrs[index][paramAttr] = true
+		}
+	}
+	return paramAttrs, nil
+}
+
+func printAttrRegistry(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tAPPLIES TO\tVALUE\tDESCRIPTION")
+	for _, spec := range attrRegistry {
+		kinds := make([]string, len(spec.AppliesTo))
+		for i, kind := range spec.AppliesTo {
+			kinds[i] = string(kind)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", spec.Name, strings.Join(kinds, ","), spec.Value, spec.Doc)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateParamAttrs(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+		err   bool
+	}{
+		{"param.title", "nostrlen", false},
+		{"param.2", "out|unsafeptr", false},
+		{"param.0", "out", false},
+		{"param.title", "", true},
+		{"param.title", "name", true},
+		{"param.title", "out|bogus", true},
+		{"param.-1", "out", true},
+		{"param.", "out", true},
+		{"param.2x", "out", true},
+	}
+	for _, test := range tests {
+		err := validateAttr(DeclFunc, test.key, test.value)
+		if test.err && err == nil {
+			t.Errorf("%s=%s: expected error", test.key, test.value)
+		} else if !test.err && err != nil {
+			t.Errorf("%s=%s: %v", test.key, test.value, err)
+		}
+	}
+}
+
+func TestResolveParamAttrs(t *testing.T) {
+	f := FunctionDecl{
+		Name: "nk_foo",
+		Params: []FunctionParam{
+			{Name: "ctx"},
+			{Name: "title"},
+			{Name: "out_x"},
+		},
+	}
+	tests := []struct {
+		name  string
+		attrs map[string]string
+		want  []map[string]bool
+		err   bool
+	}{
+		{"none", map[string]string{"nostrlen": ""}, []map[string]bool{nil, nil, nil}, false},
+		{"by name", map[string]string{"param.title": "nostrlen"},
+			[]map[string]bool{nil, {"nostrlen": true}, nil}, false},
+		{"by index", map[string]string{"param.2": "out|unsafeptr"},
+			[]map[string]bool{nil, nil, {"out": true, "unsafeptr": true}}, false},
+		{"both", map[string]string{"param.2": "out", "param.out_x": "unsafeptr"},
+			[]map[string]bool{nil, nil, {"out": true, "unsafeptr": true}}, false},
+		{"unknown name", map[string]string{"param.bogus": "out"}, nil, true},
+		{"index out of range", map[string]string{"param.3": "out"}, nil, true},
+	}
+	for _, test := range tests {
+		f.Attrs = test.attrs
+		got, err := resolveParamAttrs(f)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error, got %v", test.name, got)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// receiverNeedsCheck reports whether the receiver of a method must be
+// checked for nil: it must be a pointer whose C type does not have the
+// nilable option.
+func (g *Generator) receiverNeedsCheck(receiver ReceiverRule) bool {
+	if !strings.HasPrefix(receiver.GoType, "*") {
+		return false
+	}
+	if t, err := parseCType(receiver.CType); err == nil {
+		if conv, err := convertType(g.typeMap, t, ConvertTypeDefault); err == nil && conv.Options&TypeNilable != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// checkedFuncName returns the name of a generated function as written in
+// the message of a failed check, e.g. "(*Context).Begin".
+func checkedFuncName(receiverType, goFuncName string) string {
+	switch {
+	case receiverType == "":
+		return goFuncName
+	case strings.HasPrefix(receiverType, "*"):
+		return fmt.Sprintf("(%s).%s", receiverType, goFuncName)
+	default:
+		return receiverType + "." + goFuncName
+	}
+}
+
+// nilChecks returns statements which panic with the name of the Go function
+// if any of the named receiver or parameters is nil, before cgo is called
+// with it and crashes in C without a Go stack trace.
+func nilChecks(funcName string, names []string) string {
+	var src strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&src, "\tif %s == nil {\n", name)
+		fmt.Fprintf(&src, "\t\tpanic(%q)\n", fmt.Sprintf("%s called with nil %s", funcName, name))
+		fmt.Fprintf(&src, "\t}\n")
+	}
+	return src.String()
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Config describes every input of the generator. Without -config, it is
+// built from the command-line flags; with -config, it is read from a JSON
+// file, and only command-line flags which are set explicitly override it.
+// Relative paths in a config file are resolved against its directory.
+type Config struct {
+	// Header is the path to the nuklear header.
+	Header string `json:"header,omitempty"`
+	// Headers lists further headers, such as extensions of nuklear, which
+	// are parsed after Header as part of the same translation unit.
+	Headers []string `json:"headers,omitempty"`
+	// Include lists directories to append to the include path.
+	Include []string `json:"include,omitempty"`
+	// Defines maps macro names to values which are defined before parsing
+	// the header.
+	Defines map[string]string `json:"defines,omitempty"`
+	// CPP is the path to the C preprocessor.
+	CPP string `json:"cpp,omitempty"`
+	// Targets lists the targets to generate for; the output is constrained
+	// to build only for them, and split into several files where it differs.
+	Targets []Target `json:"targets,omitempty"`
+	// Files selects the headers whose declarations are considered by
+	// matching their paths; if it is empty, all declarations are.
+	Files PatternSource `json:"files"`
+	// Enums, Funcs and Structs select the declarations of each kind.
+	Enums   PatternSource `json:"enums"`
+	Funcs   PatternSource `json:"funcs"`
+	Structs PatternSource `json:"structs"`
+	// TypeMap maps C types to Go and cgo types.
+	TypeMap TypeMapSource `json:"typemap"`
+	// Receivers holds the rules for turning functions into methods.
+	Receivers ReceiverSource `json:"receivers"`
+	// Prefixes holds the rules for stripping prefixes from function names.
+	Prefixes PrefixSource `json:"prefixes"`
+	// Acronyms lists additional acronyms for generated identifiers.
+	Acronyms AcronymSource `json:"acronyms"`
+	// Names maps C enum and function names to the names of the Go types and
+	// functions generated for them, taking precedence over name attributes.
+	Names map[string]string `json:"names,omitempty"`
+	// Existing is the path to the directory of the target Go package, used
+	// to skip functions which are already bound.
+	Existing string       `json:"existing,omitempty"`
+	Output   OutputConfig `json:"output"`
+}
+
+// PatternSource holds patterns from a pattern file and/or inline lines
+// written in the same syntax.
+type PatternSource struct {
+	File     string   `json:"file,omitempty"`
+	Patterns []string `json:"patterns,omitempty"`
+	// inlineName and inlineDir are used for diagnostics and to resolve
+	// includes in inline lines, respectively.
+	inlineName string
+	inlineDir  string
+}
+
+type TypeMapSource struct {
+	File  string         `json:"file,omitempty"`
+	Types []TypeMapEntry `json:"types,omitempty"`
+}
+
+// TypeMapEntry is one line of a typemap file.
+type TypeMapEntry struct {
+	CType   string `json:"c"`
+	GoType  string `json:"go"`
+	CgoType string `json:"cgo"`
+	// Options is a space-separated list of type options.
+	Options string `json:"options,omitempty"`
+}
+
+type ReceiverSource struct {
+	File  string         `json:"file,omitempty"`
+	Rules []ReceiverRule `json:"rules,omitempty"`
+}
+
+type PrefixSource struct {
+	File  string       `json:"file,omitempty"`
+	Rules []PrefixRule `json:"rules,omitempty"`
+}
+
+type AcronymSource struct {
+	File     string   `json:"file,omitempty"`
+	Acronyms []string `json:"acronyms,omitempty"`
+}
+
+type OutputConfig struct {
+	// Package is the short name of the generated package.
+	Package string `json:"package"`
+	// File is the path of the generated file; standard output is used if it
+	// is empty.
+	File string `json:"file,omitempty"`
+	// Checks generates nil checks of receivers and pointer parameters, so
+	// that passing nil panics in Go instead of crashing in C.
+	Checks bool `json:"checks,omitempty"`
+	// NKDebug generates begin/end nesting checks, which are enabled by the
+	// nkdebug build tag and written to files next to File.
+	NKDebug bool `json:"nkdebug,omitempty"`
+}
+
+// loadConfig reads the JSON config file with the given name.
+func loadConfig(fileName string) (*Config, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %w", err)
+	}
+	defer file.Close()
+	cfg := &Config{
+		CPP: "cpp",
+		Output: OutputConfig{
+			Package: "nk",
+		},
+	}
+	// misspelled keys would otherwise be ignored silently
+	dec := json.NewDecoder(file)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("decoding JSON: %w", err)
+	}
+	dir := filepath.Dir(fileName)
+	resolve := func(path *string) {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
+	}
+	resolve(&cfg.Header)
+	for i := range cfg.Headers {
+		resolve(&cfg.Headers[i])
+	}
+	for i := range cfg.Include {
+		resolve(&cfg.Include[i])
+	}
+	for _, src := range []*PatternSource{&cfg.Files, &cfg.Enums, &cfg.Funcs, &cfg.Structs} {
+		resolve(&src.File)
+		src.inlineDir = dir
+	}
+	cfg.Files.inlineName = fileName + " (files.patterns)"
+	cfg.Enums.inlineName = fileName + " (enums.patterns)"
+	cfg.Funcs.inlineName = fileName + " (funcs.patterns)"
+	cfg.Structs.inlineName = fileName + " (structs.patterns)"
+	for i := range cfg.Targets {
+		resolve(&cfg.Targets[i].Predefined)
+	}
+	resolve(&cfg.TypeMap.File)
+	resolve(&cfg.Receivers.File)
+	resolve(&cfg.Prefixes.File)
+	resolve(&cfg.Acronyms.File)
+	resolve(&cfg.Existing)
+	resolve(&cfg.Output.File)
+	return cfg, nil
+}
+
+// applyFlags overrides settings with the command-line flags passed to visit,
+// which is flag.Visit to apply only explicitly set flags or flag.VisitAll to
+// apply all flags including their defaults.
+func (cfg *Config) applyFlags(visit func(fn func(*flag.Flag))) error {
+	var err error
+	var builtinTargets []Target
+	visit(func(f *flag.Flag) {
+		value := f.Value.String()
+		switch f.Name {
+		case "acronyms":
+			cfg.Acronyms.File = value
+		case "checks":
+			cfg.Output.Checks = value == "true"
+		case "cpp":
+			cfg.CPP = value
+		case "enums":
+			cfg.Enums.File = value
+		case "existing":
+			cfg.Existing = value
+		case "files":
+			cfg.Files.File = value
+		case "funcs":
+			cfg.Funcs.File = value
+		case "header":
+			cfg.Header = ""
+			cfg.Headers = nil
+			for _, header := range strings.Split(value, ",") {
+				if header = strings.TrimSpace(header); header != "" {
+					cfg.Headers = append(cfg.Headers, header)
+				}
+			}
+		case "include":
+			cfg.Include = nil
+			if value != "" {
+				cfg.Include = []string{value}
+			}
+		case "nkdebug":
+			cfg.Output.NKDebug = value == "true"
+		case "output":
+			cfg.Output.File = value
+		case "package":
+			cfg.Output.Package = value
+		case "prefixes":
+			cfg.Prefixes.File = value
+		case "receivers":
+			cfg.Receivers.File = value
+		case "target":
+			targets, targetErr := parseBuiltinTargets(value)
+			if targetErr != nil {
+				err = fmt.Errorf("invalid flag -target: %w", targetErr)
+			}
+			builtinTargets = targets
+		case "targets":
+			targets, targetErr := parseTargets(value)
+			if targetErr != nil {
+				err = fmt.Errorf("invalid flag -targets: %w", targetErr)
+			}
+			cfg.Targets = targets
+		case "typemap":
+			cfg.TypeMap.File = value
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if builtinTargets != nil {
+		if *flagTargets != "" {
+			return fmt.Errorf("flags -target and -targets cannot be used together")
+		}
+		cfg.Targets = builtinTargets
+	}
+	return nil
+}
+
+// validate checks settings which cannot be checked while loading the inputs
+// they describe.
+func (cfg *Config) validate() error {
+	if len(cfg.headers()) == 0 {
+		return fmt.Errorf("no header given")
+	} else if !identRegexp.MatchString(cfg.Output.Package) {
+		return fmt.Errorf("invalid package name '%s'", cfg.Output.Package)
+	}
+	for name, value := range cfg.Defines {
+		if !identRegexp.MatchString(name) {
+			return fmt.Errorf("invalid macro name '%s'", name)
+		} else if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("value of macro %s spans multiple lines", name)
+		}
+	}
+	for _, target := range cfg.Targets {
+		if err := target.validate(); err != nil {
+			return err
+		}
+	}
+	for cName, goName := range cfg.Names {
+		if !identRegexp.MatchString(goName) {
+			return fmt.Errorf("invalid Go name '%s' for %s", goName, cName)
+		}
+	}
+	return nil
+}
+
+// headers returns the paths of all headers to parse, in order.
+func (cfg *Config) headers() []string {
+	if cfg.Header == "" {
+		return cfg.Headers
+	}
+	return append([]string{cfg.Header}, cfg.Headers...)
+}
+
+// predefines returns the C source defining the macros in Defines.
+func (cfg *Config) predefines() string {
+	names := make([]string, 0, len(cfg.Defines))
+	for name := range cfg.Defines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var src strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&src, "#define %s %s\n", name, cfg.Defines[name])
+	}
+	return src.String()
+}
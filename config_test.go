@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "nk.json")
+	src := `{
+	"header": "nuklear.h",
+	"headers": ["/abs/ext.h"],
+	"include": ["inc"],
+	"funcs": {"file": "funcs.txt", "patterns": ["nk_begin"]},
+	"typemap": {"file": "typemap.csv"},
+	"output": {"file": "nk.go", "checks": true}
+}`
+	if err := os.WriteFile(fileName, []byte(src), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Config{
+		Header:  filepath.Join(dir, "nuklear.h"),
+		Headers: []string{"/abs/ext.h"},
+		Include: []string{filepath.Join(dir, "inc")},
+		CPP:     "cpp",
+		Files:   PatternSource{inlineName: fileName + " (files.patterns)", inlineDir: dir},
+		Enums:   PatternSource{inlineName: fileName + " (enums.patterns)", inlineDir: dir},
+		Funcs: PatternSource{
+			File:       filepath.Join(dir, "funcs.txt"),
+			Patterns:   []string{"nk_begin"},
+			inlineName: fileName + " (funcs.patterns)",
+			inlineDir:  dir,
+		},
+		Structs: PatternSource{inlineName: fileName + " (structs.patterns)", inlineDir: dir},
+		TypeMap: TypeMapSource{File: filepath.Join(dir, "typemap.csv")},
+		Output:  OutputConfig{Package: "nk", File: filepath.Join(dir, "nk.go"), Checks: true},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("got %+v, want %+v", cfg, want)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		err  string
+	}{
+		{"unknown key", `{"header": "nk.h", "fucns": {"file": "funcs.txt"}}`, `unknown field "fucns"`},
+		{"unknown nested key", `{"header": "nk.h", "output": {"pakage": "nk"}}`, `unknown field "pakage"`},
+		{"wrong type", `{"header": ["nk.h"]}`, "cannot unmarshal array"},
+		{"malformed", `{"header": "nk.h",}`, "invalid character"},
+	}
+	for _, test := range tests {
+		fileName := filepath.Join(t.TempDir(), "nk.json")
+		if err := os.WriteFile(fileName, []byte(test.src), 0o666); err != nil {
+			t.Fatal(err)
+		}
+		_, err := loadConfig(fileName)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want one containing %q", test.name, err, test.err)
+		}
+	}
+}
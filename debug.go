@@ -17,3 +17,7 @@ func debugf(format string, args ...interface{}) {
 		fmt.Fprintf(os.Stderr, "DEBUG: %s\n", fmt.Sprintf(format, args...))
 	}
 }
+
+func warnf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "WARNING: %s\n", fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"modernc.org/cc/v3"
+)
+
+var (
+	// deprecatedMacroRegexp matches nuklear's deprecation marker macro, which
+	// may take a message.
+	deprecatedMacroRegexp = regexp.MustCompile(`\bNK_DEPRECATED\b(?:\s*\(\s*"((?:[^"\\]|\\.)*)"\s*\))?`)
+	// deprecatedNoteRegexp matches a line of a comment noting that the
+	// declaration is deprecated, e.g. "DEPRECATED: use nk_foo instead"; the
+	// colon is required so that prose starting with the word does not match.
+	deprecatedNoteRegexp = regexp.MustCompile(`(?i)^deprecated:\s*(.*)$`)
+)
+
+// deprecation finds whether the declaration named name is marked deprecated
+// in the header by a GCC deprecated attribute, by the NK_DEPRECATED macro on
+// the lines from startLine to endLine, or by a note in its doc comment. It
+// returns the message given by the marker or a generic one if it is, and the
+// empty string otherwise.
+func (p *Parser) deprecation(name string, attrs []*cc.AttributeSpecifierList, fileName string, startLine,
+	endLine int, doc string) string {
+	msg, ok := "", false
+	for _, list := range attrs {
+		if msg, ok = deprecatedAttr(list); ok {
+			break
+		}
+	}
+	for line := startLine; !ok && line <= endLine; line++ {
+		if text := p.docs.line(fileName, line); text != "" {
+			if m := deprecatedMacroRegexp.FindStringSubmatch(text); m != nil {
+				msg, ok = m[1], true
+				if unquoted, err := strconv.Unquote(`"` + m[1] + `"`); err == nil {
+					msg = unquoted
+				}
+			}
+		}
+	}
+	if !ok {
+		msg, ok = deprecationNote(doc)
+	}
+	if !ok {
+		return ""
+	}
+	debugf("%s is marked deprecated in the header", name)
+	if msg == "" {
+		msg = fmt.Sprintf("%s is marked deprecated in the header.", name)
+	}
+	return msg
+}
+
+// deprecatedAttr reports whether an attribute specifier list contains the
+// deprecated attribute, and returns its message, if any.
+func deprecatedAttr(list *cc.AttributeSpecifierList) (string, bool) {
+	// attribute_specifier
+	//   : ATTRIBUTE '(' '(' attribute_value_list ')' ')'
+	//   ;
+	// attribute_value
+	//   : IDENTIFIER
+	//   | IDENTIFIER '(' expression_list ')'
+	//   ;
+	for ; list != nil; list = list.AttributeSpecifierList {
+		for avl := list.AttributeSpecifier.AttributeValueList; avl != nil; avl = avl.AttributeValueList {
+			av := avl.AttributeValue
+			if name := av.Token.String(); name != "deprecated" && name != "__deprecated__" {
+				continue
+			}
+			if av.ExpressionList == nil {
+				return "", true
+			}
+			// the token of a string literal holds its value
+			msg := nodeText(av.ExpressionList.AssignmentExpression)
+			return msg, true
+		}
+	}
+	return "", false
+}
+
+// specifierAttrs returns the attribute specifiers among declaration
+// specifiers.
+func specifierAttrs(declSpec *cc.DeclarationSpecifiers) []*cc.AttributeSpecifierList {
+	var attrs []*cc.AttributeSpecifierList
+	for ds := declSpec; ds != nil; ds = ds.DeclarationSpecifiers {
+		if ds.Case == cc.DeclarationSpecifiersAttribute {
+			attrs = append(attrs, &cc.AttributeSpecifierList{AttributeSpecifier: ds.AttributeSpecifier})
+		}
+	}
+	return attrs
+}
+
+// deprecationNote returns the rest of the first line of a comment which
+// starts with "deprecated:", in any case; the colon is required, so that
+// prose merely starting with the word is not taken for a note.
+func deprecationNote(comment string) (string, bool) {
+	for _, line := range commentLines(comment) {
+		if m := deprecatedNoteRegexp.FindStringSubmatch(line); m != nil {
+			return m[1], true
+		}
+	}
+	return "", false
+}
+
+// withDeprecation appends a Deprecated: paragraph to doc comment lines if
+// the declaration is deprecated by attrs or by the header, in that order of
+// precedence.
+func withDeprecation(doc []string, attrs map[string]string, headerMsg string) []string {
+	msg, ok := attrs[AttrDeprecated]
+	if !ok {
+		msg = headerMsg
+	}
+	if msg == "" {
+		return doc
+	} else if len(doc) != 0 {
+		doc = append(doc, "")
+	}
+	return append(doc, "Deprecated: "+msg)
+}
+
+// isDeprecationNote reports whether a cleaned comment line is a deprecation
+// note, which is replaced by a Deprecated: paragraph.
+func isDeprecationNote(line string) bool {
+	return deprecatedNoteRegexp.MatchString(strings.TrimSpace(line))
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDeprecationNote(t *testing.T) {
+	tests := []struct {
+		comment    string
+		msg        string
+		deprecated bool
+	}{
+		{"/* DEPRECATED: use nk_foo instead */", "use nk_foo instead", true},
+		{"/// Deprecated: use nk_foo instead", "use nk_foo instead", true},
+		{"/**\n * Draws a thing.\n *\n * deprecated:\n */", "", true},
+		{"/* Deprecated functions are removed elsewhere. */", "", false},
+		{"/* deprecated since 4.0, use nk_foo */", "", false},
+		{"/* Draws a deprecated thing. */", "", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		msg, deprecated := deprecationNote(test.comment)
+		if msg != test.msg || deprecated != test.deprecated {
+			t.Errorf("%q: got (%q, %v), want (%q, %v)", test.comment, msg, deprecated, test.msg, test.deprecated)
+		}
+	}
+}
+
+func TestWithDeprecation(t *testing.T) {
+	tests := []struct {
+		name      string
+		doc       []string
+		attrs     map[string]string
+		headerMsg string
+		want      []string
+	}{
+		{"none", []string{"Draws."}, nil, "", []string{"Draws."}},
+		{"header", []string{"Draws."}, nil, "use Foo", []string{"Draws.", "", "Deprecated: use Foo"}},
+		{"no doc", nil, nil, "use Foo", []string{"Deprecated: use Foo"}},
+		{"attr wins", nil, map[string]string{AttrDeprecated: "use Bar"}, "use Foo", []string{"Deprecated: use Bar"}},
+	}
+	for _, test := range tests {
+		if got := withDeprecation(test.doc, test.attrs, test.headerMsg); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestFormatDocDeprecation(t *testing.T) {
+	comment := "/* Deprecated functions are removed elsewhere.\n * DEPRECATED: use nk_foo */"
+	want := []string{"Deprecated functions are removed elsewhere."}
+	if got := formatDoc(comment, nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestParseAttrsQuoted(t *testing.T) {
+	tests := []struct {
+		line  string
+		attrs map[string]string
+		err   bool
+	}{
+		{`deprecated=use nk_foo`, map[string]string{"deprecated": "use nk_foo"}, false},
+		{`deprecated="use nk_foo, or nk_bar",nostrlen`,
+			map[string]string{"deprecated": "use nk_foo, or nk_bar", "nostrlen": ""}, false},
+		{`deprecated="say \"hi\", then go"`, map[string]string{"deprecated": `say "hi", then go`}, false},
+		{`deprecated="use nk_foo, or nk_bar`, nil, true},
+	}
+	for _, test := range tests {
+		p := &patternParser{kind: DeclFunc, presets: make(map[string]map[string]string)}
+		attrs, err := p.parseAttrs([]byte(test.line))
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error, got %v", test.line, attrs)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: %v", test.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(attrs, test.attrs) {
+			t.Errorf("%s: got %v, want %v", test.line, attrs, test.attrs)
+		}
+	}
+}
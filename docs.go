@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// docReader finds the comments documenting declarations by scanning the
+// source of the headers which declare them, since the preprocessor discards
+// comments.
+type docReader struct {
+	// files maps file names to their lines; it holds nil for files which
+	// cannot be read, such as the bundled libc headers.
+	files map[string][]string
+}
+
+func newDocReader() *docReader {
+	return &docReader{files: make(map[string][]string)}
+}
+
+func (r *docReader) lines(fileName string) []string {
+	lines, ok := r.files[fileName]
+	if !ok {
+		if data, err := os.ReadFile(fileName); err == nil {
+			lines = strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+		} else {
+			debugf("cannot read file %s for doc comments: %v", fileName, err)
+		}
+		r.files[fileName] = lines
+	}
+	return lines
+}
+
+// line returns the 1-based line of a file, or the empty string if there is
+// no such line.
+func (r *docReader) line(fileName string, line int) string {
+	lines := r.lines(fileName)
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return lines[line-1]
+}
+
+// leading returns the text of the comment which ends on the line before the
+// 1-based line, if it starts on a line of its own.
+func (r *docReader) leading(fileName string, line int) string {
+	lines := r.lines(fileName)
+	end := line - 2
+	if end < 0 || end >= len(lines) {
+		return ""
+	}
+	last := strings.TrimSpace(lines[end])
+	if strings.HasPrefix(last, "//") {
+		start := end
+		for start > 0 && strings.HasPrefix(strings.TrimSpace(lines[start-1]), "//") {
+			start--
+		}
+		return strings.Join(lines[start:end+1], "\n")
+	} else if !strings.HasSuffix(last, "*/") {
+		return ""
+	}
+	for start := end; start >= 0; start-- {
+		i := strings.Index(lines[start], "/*")
+		if i < 0 || start == end && i > strings.LastIndex(lines[end], "*/") {
+			continue
+		}
+		if strings.TrimSpace(lines[start][:i]) != "" {
+			// the comment trails the code before it
+			return ""
+		}
+		return strings.Join(lines[start:end+1], "\n")
+	}
+	return ""
+}
+
+// trailing returns the text of the comment which starts on the 1-based line
+// after the 1-based column.
+func (r *docReader) trailing(fileName string, line, column int) string {
+	lines := r.lines(fileName)
+	if line < 1 || line > len(lines) || column < 1 || column > len(lines[line-1]) {
+		return ""
+	}
+	rest := lines[line-1][column-1:]
+	if i := strings.Index(rest, "//"); i >= 0 && !strings.Contains(rest[:i], "/*") {
+		return rest[i:]
+	}
+	i := strings.Index(rest, "/*")
+	if i < 0 {
+		return ""
+	}
+	text := rest[i:]
+	for end := line; !strings.Contains(text[2:], "*/") && end < len(lines); end++ {
+		text += "\n" + lines[end]
+	}
+	// the rest of the line may hold further declarations
+	if j := strings.Index(text[2:], "*/"); j >= 0 {
+		text = text[:j+4]
+	}
+	return text
+}
+
+var (
+	docLinePrefixRegexp = regexp.MustCompile(`^\s*(?:/\*+/*|/{2,}|\*+/?)?`)
+	docParamRegexp      = regexp.MustCompile("__([A-Za-z_][A-Za-z0-9_]*?)__")
+	docTableRowRegexp   = regexp.MustCompile(`^\s*([^|]*?)\s*\|\s*(.*?)\s*$`)
+	docTableRuleRegexp  = regexp.MustCompile(`^\s*-+\s*\|[-|\s]*$`)
+)
+
+// commentLines returns the lines of the text of a C comment without the
+// comment markers and surrounding space.
+func commentLines(comment string) []string {
+	if comment == "" {
+		return nil
+	}
+	lines := strings.Split(comment, "\n")
+	for i, line := range lines {
+		line = strings.TrimSuffix(strings.TrimSpace(line), "*/")
+		lines[i] = strings.TrimSpace(docLinePrefixRegexp.ReplaceAllString(line, ""))
+	}
+	return lines
+}
+
+// formatDoc turns the text of a C comment into the lines of a Go doc
+// comment. Markdown headings and code blocks are dropped, and the rows of
+// tables of parameters become list items. Deprecation notes are dropped,
+// since they are replaced by a Deprecated: paragraph. Parameters are renamed
+// according to params, which maps C parameter names to Go names, or to the
+// empty string for parameters which the Go function does not have.
+func formatDoc(comment string, params map[string]string) []string {
+	rename := func(name string) string {
+		if goName, ok := params[name]; ok && goName != "" {
+			return goName
+		}
+		return name
+	}
+	// renameRefs replaces references to parameters written as __name__
+	renameRefs := func(text string) string {
+		return docParamRegexp.ReplaceAllStringFunc(text, func(ref string) string {
+			return rename(strings.Trim(ref, "_"))
+		})
+	}
+	var lines []string
+	inCode := false
+	inTable := false
+	for _, line := range commentLines(comment) {
+		switch {
+		case strings.HasPrefix(line, "```"):
+			inCode = !inCode
+			continue
+		case inCode || strings.HasPrefix(line, "#") || isDeprecationNote(line):
+			continue
+		case docTableRuleRegexp.MatchString(line):
+			// the header row was added as a normal line, so replace it
+			if len(lines) != 0 {
+				lines = lines[:len(lines)-1]
+			}
+			lines = append(lines, "Parameters:", "")
+			inTable = true
+			continue
+		case inTable && strings.Contains(line, "|"):
+			m := docTableRowRegexp.FindStringSubmatch(line)
+			name := strings.Trim(m[1], "_`* ")
+			if goName, ok := params[name]; ok && goName == "" {
+				continue
+			}
+			lines = append(lines, "  - "+rename(name)+": "+renameRefs(m[2]))
+			continue
+		}
+		inTable = false
+		if line == "" && (len(lines) == 0 || lines[len(lines)-1] == "") {
+			continue
+		}
+		lines = append(lines, renameRefs(line))
+	}
+	for len(lines) != 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// printDoc prints doc comment lines with the given indent.
+func (g *Generator) printDoc(indent string, lines []string) {
+	for _, line := range lines {
+		if line == "" {
+			fmt.Fprintf(g.out, "%s//\n", indent)
+		} else {
+			fmt.Fprintf(g.out, "%s// %s\n", indent, line)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFormatDoc(t *testing.T) {
+	params := map[string]string{
+		"ctx":   "ctx",
+		"title": "title",
+		"len":   "",
+		"out_x": "outX",
+	}
+	tests := []struct {
+		name    string
+		comment string
+		want    []string
+	}{
+		{
+			"line comments",
+			"// Draws a button.\n// Returns true if clicked.",
+			[]string{"Draws a button.", "Returns true if clicked."},
+		},
+		{
+			"block comment",
+			"/**\n * Draws a button.\n *\n *\n * Returns true if clicked.\n */",
+			[]string{"Draws a button.", "", "Returns true if clicked."},
+		},
+		{
+			"parameter table",
+			"/*\n * # nk_button_text\n * Draws a button.\n *\n * Parameter   | Description\n" +
+				" * ------------|------------\n * __ctx__     | Must point to a context\n" +
+				" * __title__   | Text of the button, not __len__ bytes\n * __len__     | Length of __title__\n" +
+				" * __out_x__   | Receives the x coordinate\n *\n * Returns true if clicked.\n */",
+			[]string{"Draws a button.", "", "Parameters:", "", "  - ctx: Must point to a context",
+				"  - title: Text of the button, not len bytes", "  - outX: Receives the x coordinate", "",
+				"Returns true if clicked."},
+		},
+		{
+			"references",
+			"/* Copies __out_x__ to __title__ and __unknown__. */",
+			[]string{"Copies outX to title and unknown."},
+		},
+		{
+			"code block",
+			"/*\n * Usage:\n * ```c\n * if (nk_begin(ctx, ...)) {\n * }\n * ```\n * Done.\n */",
+			[]string{"Usage:", "Done."},
+		},
+		{
+			"rule without table",
+			"/* Text | with a bar\n * but no rule */",
+			[]string{"Text | with a bar", "but no rule"},
+		},
+		{"empty", "", nil},
+	}
+	for _, test := range tests {
+		if got := formatDoc(test.comment, params); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDocReader(t *testing.T) {
+	src := `/* not a doc comment */ int a;
+
+/* Leading block
+ * comment. */
+void nk_foo(void);
+// Leading line
+// comments.
+void nk_bar(void);
+int b; /* trailing of b */
+void nk_baz(void); /* trails nk_baz */
+
+void nk_qux(void);
+enum nk_heading {NK_UP, /* up */ NK_RIGHT, NK_DOWN, NK_LEFT };
+int c; /* spans
+lines */ int d;
+`
+	fileName := filepath.Join(t.TempDir(), "doc.h")
+	if err := os.WriteFile(fileName, []byte(src), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	r := newDocReader()
+	leadingTests := []struct {
+		line int
+		want string
+	}{
+		{5, "/* Leading block\n * comment. */"},
+		{8, "// Leading line\n// comments."},
+		{10, ""},
+		{13, ""},
+		{1, ""},
+	}
+	for _, test := range leadingTests {
+		if got := r.leading(fileName, test.line); got != test.want {
+			t.Errorf("leading(%d): got %q, want %q", test.line, got, test.want)
+		}
+	}
+	if got, want := r.trailing(fileName, 10, 19), "/* trails nk_baz */"; got != want {
+		t.Errorf("trailing: got %q, want %q", got, want)
+	}
+	if got := r.trailing(fileName, 12, 19); got != "" {
+		t.Errorf("trailing of line without comment: got %q", got)
+	}
+	if got, want := r.trailing(fileName, 13, 24), "/* up */"; got != want {
+		t.Errorf("trailing followed by declarations: got %q, want %q", got, want)
+	}
+	if got, want := r.trailing(fileName, 14, 7), "/* spans\nlines */"; got != want {
+		t.Errorf("trailing spanning lines: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// docCallRegexp matches references to C functions in doc comments, such as
+// the "Foo calls nk_foo." comments emitted by this generator.
+var docCallRegexp = regexp.MustCompile(`(?:\bcalls |\bC\.)(nk_[A-Za-z0-9_]+)`)
+
+// findExistingBindings parses the Go package in dir and returns the C
+// functions which are already bound by hand-written code, mapped to a
+// description of the Go function binding them. Generated files are ignored.
+func findExistingBindings(dir string) (map[string]string, error) {
+	fileNames, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, fmt.Errorf("listing Go files: %w", err)
+	}
+	fset := token.NewFileSet()
+	existing := make(map[string]string)
+	for _, fileName := range fileNames {
+		if strings.HasSuffix(fileName, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, fileName, nil, parser.ParseComments)
+		if err != nil {
+			return nil, fmt.Errorf("parsing Go file: %w", err)
+		}
+		if isGeneratedFile(file) {
+			debugf("ignoring generated file %s", fileName)
+			continue
+		}
+		for _, decl := range file.Decls {
+			funcDecl, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			desc := fmt.Sprintf("%s at %s", goFuncDeclName(fset, funcDecl), fset.Position(funcDecl.Pos()))
+			for _, cName := range boundCFuncs(funcDecl) {
+				debugf("found existing binding of function %s by %s", cName, desc)
+				if _, ok := existing[cName]; !ok {
+					existing[cName] = desc
+				}
+			}
+		}
+	}
+	return existing, nil
+}
+
+// generatedCommentRegexp matches the comment which marks generated Go files
+// before the package clause, as recognized by Go tooling.
+var generatedCommentRegexp = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// legacyGeneratedComment marked files generated by earlier versions of this
+// generator, after the package clause.
+const legacyGeneratedComment = "// GENERATED CODE -- DO NOT EDIT"
+
+// isGeneratedFile reports whether a Go file is marked as generated.
+func isGeneratedFile(file *ast.File) bool {
+	for _, group := range file.Comments {
+		for _, comment := range group.List {
+			if comment.Pos() < file.Package && generatedCommentRegexp.MatchString(comment.Text) ||
+				comment.Text == legacyGeneratedComment {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isGeneratedSource reports whether the Go source of the named file is marked
+// as generated.
+func isGeneratedSource(fileName string, src []byte) bool {
+	file, err := parser.ParseFile(token.NewFileSet(), fileName, src, parser.ParseComments|parser.ImportsOnly)
+	return err == nil && isGeneratedFile(file)
+}
+
+// goFuncDeclName returns the name of a function declaration in the form
+// used by Go tooling, e.g. "(*Context).ButtonText".
+func goFuncDeclName(fset *token.FileSet, funcDecl *ast.FuncDecl) string {
+	if funcDecl.Recv == nil || len(funcDecl.Recv.List) == 0 {
+		return funcDecl.Name.Name
+	}
+	var recvType bytes.Buffer
+	printer.Fprint(&recvType, fset, funcDecl.Recv.List[0].Type)
+	if strings.HasPrefix(recvType.String(), "*") {
+		return fmt.Sprintf("(%s).%s", recvType.String(), funcDecl.Name.Name)
+	}
+	return fmt.Sprintf("%s.%s", recvType.String(), funcDecl.Name.Name)
+}
+
+// boundCFuncs returns the C functions referenced by the doc comment of
+// funcDecl or called by its body.
+func boundCFuncs(funcDecl *ast.FuncDecl) []string {
+	var cNames []string
+	if funcDecl.Doc != nil {
+		for _, match := range docCallRegexp.FindAllStringSubmatch(funcDecl.Doc.Text(), -1) {
+			cNames = append(cNames, match[1])
+		}
+	}
+	if funcDecl.Body == nil {
+		return cNames
+	}
+	ast.Inspect(funcDecl.Body, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Name == "C" && strings.HasPrefix(sel.Sel.Name, "nk_") {
+			cNames = append(cNames, sel.Sel.Name)
+		}
+		return true
+	})
+	return cNames
+}
+
+// existingMatcher wraps another Matcher and excludes functions which are
+// already bound in the target package.
+type existingMatcher struct {
+	Matcher
+	existing map[string]string
+	// shadowed lists the functions which were matched by patterns but
+	// excluded because they are already bound, in order.
+	shadowed []string
+}
+
+func (m *existingMatcher) MatchFunc(name string) (attrs map[string]string, ok bool) {
+	attrs, ok = m.Matcher.MatchFunc(name)
+	if _, found := m.existing[name]; found {
+		if ok {
+			m.shadowed = append(m.shadowed, name)
+		}
+		return nil, false
+	}
+	return attrs, ok
+}
+
+func NewExistingMatcher(matcher Matcher, existing map[string]string) Matcher {
+	return &existingMatcher{
+		Matcher:  matcher,
+		existing: existing,
+	}
+}
+
+func (m *existingMatcher) Decide(kind DeclKind, name string) MatchDecision {
+	decision := m.Matcher.Decide(kind, name)
+	if desc, found := m.existing[name]; found && kind == DeclFunc {
+		decision.Include = false
+		decision.Attrs = nil
+		decision.Existing = desc
+	}
+	return decision
+}
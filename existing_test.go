@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestIsGeneratedSource(t *testing.T) {
+	tests := []struct {
+		name      string
+		src       string
+		generated bool
+	}{
+		{"standard", "// Code generated by go-nk-codegen. DO NOT EDIT.\n\npackage nk\n", true},
+		{"constrained", "//go:build linux\n\n// Code generated by stringer; DO NOT EDIT.\n\npackage nk\n", true},
+		{"legacy", "package nk\n\n// GENERATED CODE -- DO NOT EDIT\n\n// #include \"nk.h\"\nimport \"C\"\n", true},
+		{"after package", "package nk\n\n// Code generated by go-nk-codegen. DO NOT EDIT.\n", false},
+		{"mention", "// Package nk wraps nuklear; DO NOT EDIT the generated files.\npackage nk\n", false},
+		{"no period", "// Code generated by hand. DO NOT EDIT\npackage nk\n", false},
+		{"hand-written", "package nk\n\n// Begin calls nk_begin.\nfunc Begin() {}\n", false},
+	}
+	for _, test := range tests {
+		if got := isGeneratedSource(test.name+".go", []byte(test.src)); got != test.generated {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.generated)
+		}
+	}
+}
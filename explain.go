@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// explain parses the headers for target and writes a description of how the
+// patterns decide whether each declaration named name is included, using the
+// same decisions as generation.
+func explain(w io.Writer, cfg *Config, in *inputs, target Target, name string) error {
+	opts, err := parseOptions(cfg, target)
+	if err != nil {
+		return err
+	}
+	// a matcher which matches nothing finds every declaration, including
+	// those in headers excluded by file patterns, without parsing any
+	headers := cfg.headers()
+	result, err := NewParser(NewPatternMatcher(nil, nil, nil, nil), opts).Parse(headers)
+	if err != nil {
+		return fmt.Errorf("parsing C declarations in headers %s: %w", strings.Join(headers, ", "), err)
+	}
+	matcher := NewPatternMatcher(in.filePatterns, in.enumPatterns, in.funcPatterns, in.structPatterns)
+	if in.existing != nil {
+		matcher = NewExistingMatcher(matcher, in.existing)
+	}
+	found := false
+	for _, ref := range result.Decls {
+		if ref.Name == name {
+			explainDecision(w, ref, result.Files[ref], matcher)
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("no declaration named %s found in headers %s", name, strings.Join(headers, ", "))
+	}
+	return nil
+}
+
+// explainDecision writes a description of how matcher decides whether the
+// declaration ref in the named file is included.
+func explainDecision(w io.Writer, ref DeclRef, fileName string, matcher Matcher) {
+	fmt.Fprintf(w, "%s %s in file %s:\n", ref.Kind, ref.Name, fileName)
+	if fileDecision := matcher.Decide(DeclFile, fileName); !fileDecision.Include {
+		explainPatterns(w, DeclFile, fileDecision.Matched)
+		if fileDecision.Pattern == nil {
+			fmt.Fprintln(w, "\tdecision: excluded because no file patterns matched its file")
+		} else {
+			fmt.Fprintf(w, "\tdecision: excluded by file pattern at %s\n", fileDecision.Pattern.Location())
+		}
+		return
+	}
+	decision := matcher.Decide(ref.Kind, ref.Name)
+	explainPatterns(w, ref.Kind, decision.Matched)
+	switch {
+	case decision.Existing != "":
+		fmt.Fprintf(w, "\tdecision: excluded because it is already bound by %s\n", decision.Existing)
+		return
+	case decision.Pattern == nil:
+		fmt.Fprintln(w, "\tno patterns matched")
+		fmt.Fprintln(w, "\tdecision: excluded")
+		return
+	case !decision.Include:
+		fmt.Fprintf(w, "\tdecision: excluded by %s\n", decision.Pattern.Location())
+		return
+	}
+	fmt.Fprintf(w, "\tdecision: included by %s\n", decision.Pattern.Location())
+	// the attributes come from the last included pattern setting each one
+	attrSources := make(map[string]*Pattern)
+	for _, pattern := range decision.Matched {
+		if pattern.Negate {
+			continue
+		}
+		for key := range pattern.Attrs {
+			attrSources[key] = pattern
+		}
+	}
+	keys := make([]string, 0, len(decision.Attrs))
+	for key := range decision.Attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		source := attrSources[key]
+		fmt.Fprintf(w, "\tattribute %s from #attrs: at %s:%d\n", formatAttr(key, decision.Attrs[key]), source.File,
+			source.AttrsLine)
+	}
+}
+
+// explainPatterns writes the patterns of the given kind which matched a
+// declaration or file.
+func explainPatterns(w io.Writer, kind DeclKind, matched []*Pattern) {
+	for _, pattern := range matched {
+		if pattern.Negate {
+			fmt.Fprintf(w, "\t%s: negated %s pattern '%s' matched\n", pattern.Location(), kind, pattern.Text)
+			continue
+		}
+		fmt.Fprintf(w, "\t%s: %s pattern '%s' matched", pattern.Location(), kind, pattern.Text)
+		if pattern.AttrsLine != 0 {
+			fmt.Fprintf(w, " with attributes %s from #attrs: at %s:%d", formatAttrs(pattern.Attrs), pattern.File,
+				pattern.AttrsLine)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func formatAttr(key, value string) string {
+	if value == "" {
+		return key
+	}
+	return key + "=" + value
+}
+
+func formatAttrs(attrs map[string]string) string {
+	strs := make([]string, 0, len(attrs))
+	for key, value := range attrs {
+		strs = append(strs, formatAttr(key, value))
+	}
+	sort.Strings(strs)
+	return strings.Join(strs, ",")
+}
@@ -1,18 +1,68 @@
 package main
 
-import "flag"
+import (
+	"flag"
+	"strings"
+)
 
 var (
+	flagAcronyms = flag.String("acronyms", "", "path to file containing additional acronyms to spell in a fixed case "+
+		"in generated identifiers, one per line as they should be written, e.g. RGBA; empty lines ignored, comment "+
+		"lines start with #; "+strings.Join(defaultAcronyms, ", ")+" are always recognized")
+	flagChecks = flag.Bool("checks", false, "generate checks which panic with the name of the Go function when a "+
+		"receiver or pointer parameter is nil, instead of crashing in C; parameters whose type has the nilable "+
+		"option are not checked")
+	flagConfig = flag.String("config", "", "path to JSON config file describing all inputs and outputs; when given, "+
+		"the other input and output flags only override it if set explicitly")
 	flagCPP   = flag.String("cpp", "cpp", "path to the C preprocessor")
 	flagDebug = flag.Bool("debug", false, "enable debug logging")
 	flagEnums = flag.String("enums", "enums.txt", "path to file containing regexps to match againsg C enums; same "+
 		"syntax as -funcs")
+	flagExisting = flag.String("existing", "", "path to directory of target Go package; C functions already called "+
+		"by its hand-written functions and methods are not generated")
+	flagExplain = flag.String("explain", "", "instead of generating code, explain which patterns match the declarations "+
+		"of the given C symbol name in the headers and whether they are included")
+	flagFiles = flag.String("files", "", "path to file containing patterns to match against the paths of the headers "+
+		"which declare C symbols; same syntax as -funcs, except that attributes are not allowed; a pattern matches a "+
+		"header if it matches its path as included or its base name; if empty, declarations in all headers are "+
+		"considered, including system headers")
 	flagFuncs = flag.String("funcs", "funcs.txt", "path to file containing regexps to match against C function "+
 		"names, one per line; empty lines ignored, comment lines start with #, and negated lines with !; patterns "+
-		"must match entire function name; set attributes with #attrs: key[=value][,...]")
-	flagHeader  = flag.String("header", "nk.h", "path to nk.h header")
-	flagInclude = flag.String("include", "", "append to include path")
-	flagPackage = flag.String("package", "nk", "package name; short name, not full path")
+		"must match entire function name; lines starting with = give an exact name and lines starting with glob: a "+
+		"shell glob instead of a regexp; set attributes with #attrs: key[=value][,...], define reusable attribute "+
+		"sets with #preset: name = key[=value][,...] and use them with #attrs: @name, and include other pattern files "+
+		"relative to the current one with #include: file")
+	flagHeader = flag.String("header", "nk.h", "comma-separated list of paths to headers to parse in order as one "+
+		"translation unit, e.g. nk.h followed by a header of custom widgets; headers after the first are included by "+
+		"base name in the generated file")
+	flagInclude   = flag.String("include", "", "append to include path")
+	flagListAttrs = flag.Bool("list-attrs", false, "instead of generating code, list the attributes which may be set in "+
+		"pattern files")
+	flagNKDebug = flag.Bool("nkdebug", false, "generate checks, enabled by the nkdebug build tag, which panic when "+
+		"an end function is called without its begin function or a frame ends with scopes open; begin functions are "+
+		"those with the pair attribute and frames end with functions with the endframe attribute; the checks are "+
+		"written to files next to -output")
+	flagOutput   = flag.String("output", "", "path to generated file; standard output if empty")
+	flagPackage  = flag.String("package", "nk", "package name; short name, not full path")
+	flagPrefixes = flag.String("prefixes", "prefixes.csv", "path to file containing prefixes to strip from C function "+
+		"names when converting them to Go names; CSV format 'receiver,prefix' where receiver is the Go receiver type or "+
+		"empty for plain functions; the longest matching prefix wins, otherwise nk_ is stripped")
+	flagReceivers = flag.String("receivers", "receivers.csv", "path to file containing rules for turning functions "+
+		"into methods based on the C type of their first parameter; CSV format 'ctype,name,gotype[,expr]'; empty lines "+
+		"ignored, comment lines start with #")
+	flagReport = flag.String("report", "", "instead of generating code, report the status of every nk_* enum, function "+
+		"and struct in the header; format is 'text' or 'json'")
+	flagTarget = flag.String("target", "", "comma-separated list of targets to generate for using builtin profiles, "+
+		"each given as goos/goarch; a builtin profile supplies the target's predefined macros and a minimal set of libc "+
+		"headers, so no C preprocessor is needed; cannot be combined with -targets; available profiles are "+
+		strings.Join(builtinProfiles(), ", "))
+	flagTargets = flag.String("targets", "", "comma-separated list of targets to generate for, each given as "+
+		"goos/goarch[=file] where file holds the target's predefined macros, e.g. the output of its cpp -dM; with "+
+		"several targets, outputs which differ are written to separate files next to -output; outputs are "+
+		"constrained to build only for the targets, and targets other than the host need a file or -target")
 	flagTypemap = flag.String("typemap", "typemap.csv", "path to file containing type mappings from C to Go and cgo; "+
-		"one mapping per line; CSV format 'ctype,gotype,cgotype'; empty lines ignored, comment lines start with #")
+		"one mapping per line; CSV format 'ctype,gotype,cgotype[,options]' where options are separated by spaces and are "+
+		"any of unsafeptr, byvalue, nilable, noautoptr and cstring-nolen; ctype may be a regexp prefixed with regexp: or "+
+		"a glob prefixed with glob:, whose captures are substituted for $1 etc. in gotype and cgotype; empty lines "+
+		"ignored, comment lines start with #")
 )
@@ -1,12 +1,13 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
-
-	"github.com/iancoleman/strcase"
 )
 
 func main() {
@@ -18,46 +19,359 @@ func main() {
 }
 
 func run() error {
-	enumPatterns, err := parsePatterns(*flagEnums)
+	if *flagListAttrs {
+		return printAttrRegistry(os.Stdout)
+	}
+	if *flagReport != "" && *flagReport != "text" && *flagReport != "json" {
+		return fmt.Errorf("unknown report format '%s'", *flagReport)
+	}
+	cfg := &Config{}
+	var err error
+	if *flagConfig != "" {
+		if cfg, err = loadConfig(*flagConfig); err != nil {
+			return fmt.Errorf("loading config file '%s': %w", *flagConfig, err)
+		}
+		err = cfg.applyFlags(flag.Visit)
+	} else {
+		err = cfg.applyFlags(flag.VisitAll)
+	}
 	if err != nil {
-		return fmt.Errorf("parsing enum patterns in file '%s': %w", *flagEnums, err)
+		return err
+	}
+	if err := cfg.validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
 	}
-	funcPatterns, err := parsePatterns(*flagFuncs)
+	acronymList, err := loadAcronyms(cfg.Acronyms)
 	if err != nil {
-		return fmt.Errorf("parsing function patterns in file '%s': %w", *flagFuncs, err)
+		return fmt.Errorf("loading acronyms: %w", err)
+	}
+	addAcronyms(acronymList)
+	filePatterns, err := parsePatterns(cfg.Files, DeclFile)
+	if err != nil {
+		return fmt.Errorf("parsing file patterns: %w", err)
+	}
+	enumPatterns, err := parsePatterns(cfg.Enums, DeclEnum)
+	if err != nil {
+		return fmt.Errorf("parsing enum patterns: %w", err)
+	}
+	funcPatterns, err := parsePatterns(cfg.Funcs, DeclFunc)
+	if err != nil {
+		return fmt.Errorf("parsing function patterns: %w", err)
+	}
+	structPatterns, err := parsePatterns(cfg.Structs, DeclStruct)
+	if err != nil {
+		return fmt.Errorf("parsing struct patterns: %w", err)
+	}
+	var existing map[string]string
+	if cfg.Existing != "" {
+		existing, err = findExistingBindings(cfg.Existing)
+		if err != nil {
+			return fmt.Errorf("finding existing bindings in directory '%s': %w", cfg.Existing, err)
+		}
+	}
+	typeMap, err := loadTypeMap(cfg.TypeMap)
+	if err != nil {
+		return fmt.Errorf("loading typemap: %w", err)
+	}
+	receivers, err := loadReceiverRules(cfg.Receivers)
+	if err != nil {
+		return fmt.Errorf("loading receiver rules: %w", err)
+	}
+	prefixes, err := loadPrefixRules(cfg.Prefixes)
+	if err != nil {
+		return fmt.Errorf("loading prefix rules: %w", err)
+	}
+	in := &inputs{
+		filePatterns:   filePatterns,
+		enumPatterns:   enumPatterns,
+		funcPatterns:   funcPatterns,
+		structPatterns: structPatterns,
+		existing:       existing,
+		typeMap:        typeMap,
+		receivers:      receivers,
+		prefixes:       prefixes,
+	}
+	reporting := *flagReport != ""
+	targets := cfg.Targets
+	if len(targets) == 0 {
+		// the host, or GOOS and GOARCH if they are set
+		targets = []Target{{}}
+	} else if len(targets) > 1 && cfg.Output.File == "" && !reporting {
+		return fmt.Errorf("an output file is required to generate for multiple targets")
+	}
+	if *flagExplain != "" {
+		// the explanation is for the first target only
+		return explain(os.Stdout, cfg, in, targets[0], *flagExplain)
+	}
+	if cfg.Output.NKDebug && cfg.Output.File == "" && !reporting {
+		return fmt.Errorf("an output file is required to generate nesting checks")
+	}
+	gens := make([]*generation, len(targets))
+	deadCounts := make(map[*Pattern]int)
+	for i, target := range targets {
+		if gens[i], err = generate(cfg, in, target, reporting); err != nil && target.GOOS != "" {
+			return fmt.Errorf("generating for target %s: %w", target, err)
+		} else if err != nil {
+			return err
+		}
+		for _, pattern := range gens[i].matcher.DeadPatterns() {
+			deadCounts[pattern]++
+		}
+	}
+	if reporting {
+		// the report is for the first target only
+		report := buildReport(gens[0].result, gens[0].matcher, gens[0].failures)
+		if err := printReport(os.Stdout, report, *flagReport); err != nil {
+			return fmt.Errorf("printing report: %w", err)
+		}
+	} else if len(cfg.Targets) != 0 && cfg.Output.File != "" {
+		outputs := make([][]byte, len(gens))
+		for i, gen := range gens {
+			outputs[i] = gen.output
+		}
+		if err := writeTargetOutputs(cfg.Output.File, targets, outputs); err != nil {
+			return fmt.Errorf("writing output: %w", err)
+		}
+	} else if cfg.Output.File != "" {
+		if err := os.WriteFile(cfg.Output.File, gens[0].output, 0o666); err != nil {
+			return fmt.Errorf("writing output: %w", err)
+		}
+	} else if _, err := os.Stdout.Write(gens[0].output); err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
+	if cfg.Output.NKDebug && !reporting {
+		if err := writeNKDebugFiles(cfg.Output.File, cfg.Output.Package); err != nil {
+			return fmt.Errorf("writing nesting checks: %w", err)
+		}
+	}
+	// warn once about each function which is matched but already bound,
+	// however many targets it is matched for
+	warned := make(map[string]bool)
+	for _, gen := range gens {
+		m, ok := gen.matcher.(*existingMatcher)
+		if !ok {
+			continue
+		}
+		for _, name := range m.shadowed {
+			if !warned[name] {
+				warned[name] = true
+				warnf("function %s is matched by patterns but already defined by %s", name, in.existing[name])
+			}
+		}
 	}
-	typeMap, err := parseTypeMap(*flagTypemap)
+	// warn about patterns which are dead for every target, in order
+	for _, pattern := range gens[0].matcher.DeadPatterns() {
+		if deadCounts[pattern] != len(targets) {
+			continue
+		}
+		negation := ""
+		if pattern.Negate {
+			negation = "negated "
+		}
+		warnf("%s: %spattern '%s' did not match any declaration", pattern.Location(), negation, pattern.Text)
+	}
+	return nil
+}
+
+// inputs holds the loaded inputs of the generator other than the headers.
+type inputs struct {
+	filePatterns   []Pattern
+	enumPatterns   []Pattern
+	funcPatterns   []Pattern
+	structPatterns []Pattern
+	existing       map[string]string
+	typeMap        *TypeMap
+	receivers      []ReceiverRule
+	prefixes       []PrefixRule
+}
+
+// generation is the result of generating bindings for one target.
+type generation struct {
+	output  []byte
+	result  ParseResult
+	matcher Matcher
+	// failures holds the errors for declarations which could not be
+	// generated; it is only filled in when reporting.
+	failures map[DeclRef]error
+}
+
+// parseOptions returns the options for parsing the headers for target, which
+// is the host if it is the zero Target.
+func parseOptions(cfg *Config, target Target) (ParseOptions, error) {
+	opts := ParseOptions{
+		CPP:          cfg.CPP,
+		IncludePaths: cfg.Include,
+		Predefined:   cfg.predefines(),
+		GOOS:         target.GOOS,
+		GOARCH:       target.GOARCH,
+		Builtin:      target.Builtin,
+	}
+	if target.Builtin {
+		predefined, err := builtinPredefined(target)
+		if err != nil {
+			return ParseOptions{}, err
+		}
+		opts.TargetPredefined = predefined
+	} else if target.Predefined != "" {
+		data, err := os.ReadFile(target.Predefined)
+		if err != nil {
+			return ParseOptions{}, fmt.Errorf("reading predefined macros: %w", err)
+		}
+		opts.TargetPredefined = string(data)
+	}
+	return opts, nil
+}
+
+// generate parses the header for target, which is the host if it is the zero
+// Target, and generates bindings. When reporting, declarations which cannot
+// be generated are recorded as failures instead of causing an error.
+func generate(cfg *Config, in *inputs, target Target, reporting bool) (*generation, error) {
+	matcher := NewPatternMatcher(in.filePatterns, in.enumPatterns, in.funcPatterns, in.structPatterns)
+	if in.existing != nil {
+		matcher = NewExistingMatcher(matcher, in.existing)
+	}
+	opts, err := parseOptions(cfg, target)
 	if err != nil {
-		return fmt.Errorf("parsing typemap in file '%s': %w", *flagTypemap, err)
+		return nil, err
 	}
-	parser := NewParser(NewPatternMatcher(enumPatterns, funcPatterns, nil))
-	result, err := parser.Parse(*flagHeader)
+	opts.KeepGoing = reporting
+	headers := cfg.headers()
+	result, err := NewParser(matcher, opts).Parse(headers)
 	if err != nil {
-		return fmt.Errorf("parsing C functions in file '%s': %w", *flagHeader, err)
-	}
-	fmt.Println("package", *flagPackage)
-	fmt.Println()
-	fmt.Println("// GENERATED CODE -- DO NOT EDIT")
-	fmt.Println()
-	fmt.Println(`// #include "nk.h"`)
-	fmt.Println(`import "C"`)
-	fmt.Println()
-	fmt.Println(`import "unsafe"`)
+		return nil, fmt.Errorf("parsing C functions in headers %s: %w", strings.Join(headers, ", "), err)
+	}
+	// exact names must be declared in the headers the file patterns select
+	var decls []DeclRef
+	for _, ref := range result.Decls {
+		if matcher.Decide(DeclFile, result.Files[ref]).Include {
+			decls = append(decls, ref)
+		}
+	}
+	if err := checkExactPatterns(DeclEnum, in.enumPatterns, decls); err != nil {
+		return nil, fmt.Errorf("checking enum patterns: %w", err)
+	}
+	if err := checkExactPatterns(DeclFunc, in.funcPatterns, decls); err != nil {
+		return nil, fmt.Errorf("checking function patterns: %w", err)
+	}
+	if err := checkExactPatterns(DeclStruct, in.structPatterns, decls); err != nil {
+		return nil, fmt.Errorf("checking struct patterns: %w", err)
+	}
+	var out bytes.Buffer
+	failures := make(map[DeclRef]error)
+	for ref, err := range result.Failures {
+		failures[ref] = err
+	}
+	gen := NewGenerator(&out, in.typeMap, in.receivers, in.prefixes, cfg.Names)
+	gen.checks = cfg.Output.Checks
+	gen.renameEnums(result.Enums)
+	if cfg.Output.NKDebug {
+		gen.nkdebug = true
+		gen.ends = make(map[string]bool)
+		for _, f := range result.Funcs {
+			if f.End != nil {
+				gen.ends[f.End.Name] = true
+			}
+		}
+	}
+	gen.printHeader(cfg.Output.Package, headers[1:])
 	for _, e := range result.Enums {
-		if err := printEnum(e); err != nil {
-			return fmt.Errorf("printing definition of enum %s: %w", e.Name, err)
+		if err := gen.printEnum(e); err != nil && reporting {
+			failures[DeclRef{Kind: DeclEnum, Name: e.Name}] = err
+		} else if err != nil {
+			return nil, fmt.Errorf("printing definition of enum %s: %w", e.Name, err)
 		}
 	}
 	for _, f := range result.Funcs {
-		if err := printFunc(typeMap, f, ""); err != nil {
-			return fmt.Errorf("printing definition of function %s: %w", f.Name, err)
+		if err := gen.printFunc(f); err != nil && reporting {
+			failures[DeclRef{Kind: DeclFunc, Name: f.Name}] = err
+		} else if err != nil {
+			return nil, fmt.Errorf("printing definition of function %s: %w", f.Name, err)
 		}
 	}
-	return nil
+	return &generation{
+		output:   out.Bytes(),
+		result:   result,
+		matcher:  matcher,
+		failures: failures,
+	}, nil
 }
 
-func printEnum(e EnumDecl) error {
-	typeName := strcase.ToCamel(strings.TrimPrefix(e.Name, "nk_"))
+// generatedComment marks generated files; it precedes the package clause.
+const generatedComment = "// Code generated by go-nk-codegen. DO NOT EDIT."
+
+// Generator prints Go bindings for parsed C declarations.
+type Generator struct {
+	out       io.Writer
+	typeMap   *TypeMap
+	receivers []ReceiverRule
+	prefixes  []PrefixRule
+	// overrides maps C names to Go names, taking precedence over AttrName.
+	overrides map[string]string
+	names     *namespace
+	// checks enables the nil checks of receivers and pointer parameters.
+	checks bool
+	// nkdebug enables the begin/end nesting checks, and ends holds the names
+	// of the end functions of pairs for them.
+	nkdebug bool
+	ends    map[string]bool
+}
+
+func NewGenerator(out io.Writer, typeMap *TypeMap, receivers []ReceiverRule, prefixes []PrefixRule,
+	overrides map[string]string) *Generator {
+	return &Generator{
+		out:       out,
+		typeMap:   typeMap,
+		receivers: receivers,
+		prefixes:  prefixes,
+		overrides: overrides,
+		names:     newNamespace(),
+	}
+}
+
+// goName returns the Go name for the C declaration cName from the overrides
+// or the attributes, if either sets one.
+func (g *Generator) goName(cName string, attrs map[string]string) (string, bool) {
+	if name, ok := g.overrides[cName]; ok {
+		return name, true
+	}
+	name, ok := attrs[AttrName]
+	return name, ok
+}
+
+// renameEnums makes the enum types converted automatically use the names of
+// the Go types generated for enums which are renamed by the overrides or
+// attributes.
+func (g *Generator) renameEnums(enums []EnumDecl) {
+	names := make(map[string]string)
+	for _, e := range enums {
+		if name, ok := g.goName(e.Name, e.Attrs); ok {
+			names["enum "+e.Name] = name
+		}
+	}
+	g.typeMap = g.typeMap.withEnumNames(names)
+}
+
+// printHeader prints the start of the file, including the nk.h wrapper of the
+// target package and the extra headers, which are included by base name.
+func (g *Generator) printHeader(packageName string, extraHeaders []string) {
+	fmt.Fprintln(g.out, generatedComment)
+	fmt.Fprintln(g.out)
+	fmt.Fprintln(g.out, "package", packageName)
+	fmt.Fprintln(g.out)
+	fmt.Fprintln(g.out, `// #include "nk.h"`)
+	for _, header := range extraHeaders {
+		fmt.Fprintf(g.out, "// #include \"%s\"\n", filepath.Base(header))
+	}
+	fmt.Fprintln(g.out, `import "C"`)
+	fmt.Fprintln(g.out)
+	fmt.Fprintln(g.out, `import "unsafe"`)
+}
+
+func (g *Generator) printEnum(e EnumDecl) error {
+	typeName, ok := g.goName(e.Name, e.Attrs)
+	if !ok {
+		typeName = exportedName(strings.TrimPrefix(e.Name, "nk_"))
+	}
 	untyped := false
 	if _, ok := e.Attrs[AttrUntyped]; ok {
 		untyped = true
@@ -65,72 +379,120 @@ func printEnum(e EnumDecl) error {
 	var names []string
 	var maxNameLen int
 	for _, con := range e.Constants {
-		name := strcase.ToCamel(strings.ToLower(strings.TrimPrefix(con, "NK_")))
-		// fix some common acronyms
-		name = strings.ReplaceAll(name, "Uv", "UV")
-		name = strings.ReplaceAll(name, "Rgba", "RGBA")
-		name = strings.ReplaceAll(name, "Rgb", "RGB")
+		name := exportedName(strings.ToLower(strings.TrimPrefix(con.Name, "NK_")))
+		if err := g.names.declare("", name, "constant "+con.Name); err != nil {
+			return err
+		}
 		names = append(names, name)
 		if len(name) > maxNameLen {
 			maxNameLen = len(name)
 		}
 	}
 	if !untyped {
-		fmt.Println()
-		fmt.Printf("// %s is equivalent to enum %s.\n", typeName, e.Name)
-		fmt.Printf("type %s int32\n", typeName)
+		if err := g.names.declare("", typeName, "enum "+e.Name); err != nil {
+			return err
+		}
+		fmt.Fprintln(g.out)
+		fmt.Fprintf(g.out, "// %s is equivalent to enum %s.\n", typeName, e.Name)
+		if doc := withDeprecation(formatDoc(e.Doc, nil), e.Attrs, e.Deprecated); len(doc) != 0 {
+			fmt.Fprintln(g.out, "//")
+			g.printDoc("", doc)
+		}
+		fmt.Fprintf(g.out, "type %s int32\n", typeName)
 	}
-	fmt.Println()
+	fmt.Fprintln(g.out)
 	if untyped {
-		fmt.Printf("// constants for enum %s:\n", e.Name)
+		fmt.Fprintf(g.out, "// constants for enum %s:\n", e.Name)
+		if doc := formatDoc(e.Doc, nil); len(doc) != 0 {
+			fmt.Fprintln(g.out, "//")
+			g.printDoc("", doc)
+		}
 	}
-	fmt.Println("const (")
+	fmt.Fprintln(g.out, "const (")
 	for i, name := range names {
+		// a deprecated enum deprecates all of its constants
+		deprecated := e.Constants[i].Deprecated
+		if deprecated == "" {
+			deprecated = e.Deprecated
+		}
+		g.printDoc("\t", withDeprecation(formatDoc(e.Constants[i].Doc, nil), e.Attrs, deprecated))
 		if untyped {
-			fmt.Printf("\t%*s = C.%s\n", -maxNameLen, name, e.Constants[i])
+			fmt.Fprintf(g.out, "\t%*s = C.%s\n", -maxNameLen, name, e.Constants[i].Name)
 		} else {
-			fmt.Printf("\t%*s %s = C.%s\n", -maxNameLen, name, typeName, e.Constants[i])
+			fmt.Fprintf(g.out, "\t%*s %s = C.%s\n", -maxNameLen, name, typeName, e.Constants[i].Name)
 		}
 	}
-	fmt.Println(")")
+	fmt.Fprintln(g.out, ")")
 	return nil
 }
 
-func printFunc(typeMap map[string]TypeConv, f FunctionDecl, doc string) error {
-	nakedName := strings.TrimPrefix(f.Name, "nk_")
-	goFuncName := strcase.ToCamel(nakedName)
-	method := true
-	goParamOffset := 1
-	if len(f.Params) == 0 || f.Params[0].Type != "struct nk_context *" {
-		method = false
-		debugf("marking function %s as not a method because its first parameter is not typed 'struct nk_context *'",
-			f.Name)
-		goParamOffset = 0
+func (g *Generator) printFunc(f FunctionDecl) error {
+	var receiver ReceiverRule
+	method := false
+	goParamOffset := 0
+	if len(f.Params) == 0 {
+		debugf("marking function %s as not a method because it has no parameters", f.Name)
+	} else if rule, ok := findReceiverRule(g.receivers, f.Params[0].Type); !ok {
+		debugf("marking function %s as not a method because no receiver rule matches its first parameter type '%s'",
+			f.Name, f.Params[0].Type)
+	} else {
+		receiver = rule
+		method = true
+		goParamOffset = 1
+	}
+	goFuncName, ok := g.goName(f.Name, f.Attrs)
+	if !ok {
+		goFuncName = exportedName(stripPrefix(g.prefixes, receiver.GoType, f.Name))
+	}
+	paramAttrs, err := resolveParamAttrs(f)
+	if err != nil {
+		return err
+	}
+	// hasAttr reports whether a parameter attribute is set on the parameter
+	// or on the whole function
+	hasAttr := func(cParamIndex int, attr string) bool {
+		if _, ok := f.Attrs[attr]; ok {
+			return true
+		}
+		return paramAttrs[cParamIndex][attr]
 	}
 	goParamTypes := make([]string, len(f.Params)-goParamOffset)
 	goParams := make([]string, len(f.Params)-goParamOffset)
 	cParams := make([]string, len(f.Params))
 	goNameCounts := make(map[string]int)
+	if method {
+		// reserve the receiver name so no parameter shadows it
+		goNameCounts[receiver.Name]++
+	}
 	var preamble strings.Builder
+	var outNames, outTypes []string
+	// nilChecked are the Go names of the parameters checked for nil
+	var nilChecked []string
+	// docParams maps C parameter names to Go names for the doc comment
+	docParams := make(map[string]string)
+	if method {
+		docParams[f.Params[0].Name] = receiver.Name
+	}
 	for i := goParamOffset; i < len(f.Params); i++ {
 		// convert type
 		cParamIndex := i
 		goParamIndex := i - goParamOffset
 		cParam := f.Params[cParamIndex]
-		goType, cgoType, err := convertType(typeMap, cParam.Type, ConvertTypeDefault)
+		conv, err := convertType(g.typeMap, cParam.Type, ConvertTypeDefault)
+		goType, cgoType := conv.GoType, conv.CgoType
 		if err != nil {
 			return fmt.Errorf("converting type '%s' of parameter %d: %w", cParam.Type, i, err)
 		} else if goType == "" {
 			return fmt.Errorf("no type mapped for parameter %d", i)
 		}
 		// infer and validate parameter name
-		goName := strcase.ToLowerCamel(cParam.Name)
+		goName := unexportedName(cParam.Name)
 		if goName == "" {
 			semanticType := goType
 			for strings.HasPrefix(semanticType, "*") {
 				semanticType = strings.TrimPrefix(semanticType, "*")
 			}
-			goName = strcase.ToLowerCamel(semanticType)
+			goName = unexportedName(semanticType)
 		}
 		switch goName {
 		case "string":
@@ -161,91 +523,244 @@ func printFunc(typeMap map[string]TypeConv, f FunctionDecl, doc string) error {
 				goName = fmt.Sprintf("%s%d", goName, nameCount)
 			}
 		}
+		docParams[cParam.Name] = goName
+		unsafePtr := hasAttr(cParamIndex, AttrUnsafePtr) || conv.Options&TypeUnsafePtr != 0
+		// check for out parameters, which are returned instead of passed
+		if hasAttr(cParamIndex, AttrOut) {
+			if !strings.HasPrefix(cgoType, "*") || !conv.byValue() && !strings.HasPrefix(goType, "*") {
+				return fmt.Errorf("out parameter %d is not a pointer", i)
+			}
+			outType := goType
+			if !conv.byValue() {
+				outType = strings.TrimPrefix(goType, "*")
+			}
+			fmt.Fprintf(&preamble, "\tvar %s %s\n", goName, outType)
+			cParams[cParamIndex] = cgoParamExpr("&"+goName, cgoType, unsafePtr)
+			goParams[goParamIndex] = "__DELETED__"
+			outNames = append(outNames, goName)
+			outTypes = append(outTypes, outType)
+			continue
+		}
+		if g.checks && strings.HasPrefix(goType, "*") && conv.Options&TypeNilable == 0 {
+			nilChecked = append(nilChecked, goName)
+		}
 		// check for CStrings
 		if cgoType == "C.CString" {
-			rawName := fmt.Sprintf("raw%s", strcase.ToCamel(goName))
-			fmt.Fprintf(&preamble, "\t%s := cStringPool.Get(%s)\n", rawName, goName)
-			fmt.Fprintf(&preamble, "\tdefer cStringPool.Release(%s)\n", rawName)
+			rawName := fmt.Sprintf("raw%s", exportedName(goName))
+			if conv.Options&TypeNilable != 0 {
+				// pass NULL for the empty string
+				fmt.Fprintf(&preamble, "\tvar %s *C.char\n", rawName)
+				fmt.Fprintf(&preamble, "\tif %s != \"\" {\n", goName)
+				fmt.Fprintf(&preamble, "\t\t%s = cStringPool.Get(%s)\n", rawName, goName)
+				fmt.Fprintf(&preamble, "\t\tdefer cStringPool.Release(%s)\n", rawName)
+				fmt.Fprintf(&preamble, "\t}\n")
+			} else {
+				fmt.Fprintf(&preamble, "\t%s := cStringPool.Get(%s)\n", rawName, goName)
+				fmt.Fprintf(&preamble, "\tdefer cStringPool.Release(%s)\n", rawName)
+			}
 			cParams[cParamIndex] = rawName
-			if _, ok := f.Attrs["nostrlen"]; !ok {
+			if !hasAttr(cParamIndex, AttrNoStrLen) && conv.Options&TypeCStringNoLen == 0 {
 				// skip over the next param in the normal loop
 				i++
 				nextCParamIndex := i
 				nextGoParamIndex := i - goParamOffset
 				// ensure it is an int
-				if nextCParamIndex >= len(f.Params) || f.Params[nextCParamIndex].Type != "int" {
+				if nextCParamIndex >= len(f.Params) || f.Params[nextCParamIndex].Type.Key() != "int" {
 					return fmt.Errorf("string parameter %d is not followed by length param (set attr nostrlen to override)", i)
 				}
 				// synthesize a C parameter set to the string length
 				cParams[nextCParamIndex] = fmt.Sprintf("C.int(len(%s))", goName)
 				// put a sentinel value in for the Go parameter
 				goParams[nextGoParamIndex] = "__DELETED__"
+				docParams[f.Params[nextCParamIndex].Name] = ""
 			}
 		} else if len(cgoType) == 0 {
 			cParams[cParamIndex] = goName
 		} else if goType == "Handle" {
 			cParams[cParamIndex] = fmt.Sprintf("%s.raw()", goName)
+		} else if conv.byValue() {
+			cParams[cParamIndex] = cgoParamExpr("&"+goName, cgoType, unsafePtr)
 		} else {
-			var paramFormat string
-			_, hasAttrUnsafePtr := f.Attrs[AttrUnsafePtr]
-			if strings.HasPrefix(cgoType, "*C.struct_") || strings.HasPrefix(cgoType, "*") && hasAttrUnsafePtr {
-				paramFormat = "(%s)(unsafe.Pointer(%s))"
-			} else if strings.HasPrefix(cgoType, "C.struct_") {
-				paramFormat = "*(*%s)(unsafe.Pointer(&%s))"
-			} else {
-				paramFormat = "(%s)(%s)"
-			}
-			cParams[cParamIndex] = fmt.Sprintf(paramFormat, cgoType, goName)
+			cParams[cParamIndex] = cgoParamExpr(goName, cgoType, unsafePtr)
 		}
 		goParamTypes[goParamIndex] = goType
 		goParams[goParamIndex] = fmt.Sprintf("%s %s", goName, goType)
 	}
+	keptGoParams := goParams[:0]
+	keptGoParamTypes := goParamTypes[:0]
 	for i, p := range goParams {
 		switch p {
-		// delete parameters which aren't needed after CString handling
+		// delete parameters which aren't needed after CString and out
+		// parameter handling
 		case "__DELETED__":
-			goParams = append(goParams[:i], goParams[i+1:]...)
-			goParamTypes = append(goParamTypes[:i], goParamTypes[i+1:]...)
+			continue
 		case "":
 			return fmt.Errorf("parameter %d assigned no name", i)
 		}
+		keptGoParams = append(keptGoParams, p)
+		keptGoParamTypes = append(keptGoParamTypes, goParamTypes[i])
 	}
+	goParams, goParamTypes = keptGoParams, keptGoParamTypes
 	if method {
-		cParams[0] = "ctx.raw()"
+		if receiver.Expr != "" {
+			cParams[0] = fmt.Sprintf(receiver.Expr, receiver.Name)
+		} else {
+			receiverType, err := parseCType(receiver.CType)
+			if err != nil {
+				return fmt.Errorf("parsing type '%s' of receiver: %w", receiver.CType, err)
+			}
+			conv, err := convertType(g.typeMap, receiverType, ConvertTypeDefault)
+			if err != nil {
+				return fmt.Errorf("converting type '%s' of receiver: %w", receiver.CType, err)
+			}
+			_, hasAttrUnsafePtr := f.Attrs[AttrUnsafePtr]
+			unsafePtr := hasAttrUnsafePtr || conv.Options&TypeUnsafePtr != 0
+			if conv.byValue() {
+				cParams[0] = cgoParamExpr("&"+receiver.Name, conv.CgoType, unsafePtr)
+			} else {
+				cParams[0] = cgoParamExpr(receiver.Name, conv.CgoType, unsafePtr)
+			}
+		}
 	}
-	retType, _, err := convertType(typeMap, f.Return, ConvertTypeDefault)
+	retConv, err := convertType(g.typeMap, f.Return, ConvertTypeDefault)
+	retType := retConv.GoType
 	if err != nil {
 		return fmt.Errorf("converting type '%s' of return: %w", f.Return, err)
+	} else if strings.HasPrefix(retType, "*") || retConv.byValue() {
+		return fmt.Errorf("pointer return")
 	}
 	namedMethodReceiver := ""
 	if method {
-		namedMethodReceiver = "(ctx *Context) "
+		namedMethodReceiver = fmt.Sprintf("(%s %s) ", receiver.Name, receiver.GoType)
+	}
+	if err := g.names.declare(receiver.GoType, goFuncName, "function "+f.Name); err != nil {
+		return err
 	}
 	paramList := strings.Join(goParams, ", ")
 	castList := strings.Join(cParams, ", ")
-	fmt.Println()
-	if doc == "" {
-		doc = fmt.Sprintf("%s calls %s.", goFuncName, f.Name)
-	}
-	fmt.Println("//", doc)
-	if retType == "" {
-		fmt.Printf("func %s%s(%s) {\n", namedMethodReceiver, goFuncName, paramList)
-		fmt.Print(preamble.String())
-		fmt.Printf("\tC.%s(%s)\n", f.Name, castList)
-	} else {
-		fmt.Printf("func %s%s(%s) %s {\n", namedMethodReceiver, goFuncName, paramList, retType)
-		fmt.Print(preamble.String())
-		if retType[0] >= 'a' && retType[0] <= 'z' {
-			fmt.Printf("\treturn (%s)(C.%s(%s))\n", retType, f.Name, castList)
+	fmt.Fprintln(g.out)
+	var helper string
+	if f.End != nil {
+		begin := beginFunc{
+			decl:   f,
+			goName: goFuncName,
+			params: goParams,
+			result: retType,
+		}
+		if method {
+			begin.receiver = &receiver
+			begin.firstCParam = cParams[0]
+		}
+		if len(outNames) != 0 {
+			return fmt.Errorf("paired function cannot have out parameters")
+		} else if helper, err = g.pairHelper(begin); err != nil {
+			return err
+		}
+	} else if _, ok := f.Attrs[AttrPairAlways]; ok {
+		return fmt.Errorf("attribute %s requires attribute %s", AttrPairAlways, AttrPair)
+	} else if _, ok := f.Attrs[AttrPairName]; ok {
+		return fmt.Errorf("attribute %s requires attribute %s", AttrPairName, AttrPair)
+	}
+	// begin/end nesting checks, if enabled
+	debugKey := "nil"
+	if method {
+		debugKey = receiver.Name
+	}
+	var debugBegin string
+	pre := preamble.String()
+	if g.nkdebug {
+		if _, ok := f.Attrs[AttrEndFrame]; ok {
+			pre = fmt.Sprintf("\tnkdebugEndFrame(%s, %q)\n", debugKey, f.Name) + pre
+		}
+		if g.ends[f.Name] {
+			pre = fmt.Sprintf("\tnkdebugEnd(%s, %q)\n", debugKey, f.Name) + pre
+		}
+		if f.End != nil {
+			debugBegin = fmt.Sprintf("nkdebugBegin(%s, %q, %q)", debugKey, f.Name, f.End.Name)
+		}
+	}
+	// nil checks, if enabled, come first so nothing else touches nil
+	if g.checks {
+		if method && g.receiverNeedsCheck(receiver) {
+			nilChecked = append([]string{receiver.Name}, nilChecked...)
+		}
+		pre = nilChecks(checkedFuncName(receiver.GoType, goFuncName), nilChecked) + pre
+	}
+	fmt.Fprintf(g.out, "// %s calls %s.\n", goFuncName, f.Name)
+	if doc := withDeprecation(formatDoc(f.Doc, docParams), f.Attrs, f.Deprecated); len(doc) != 0 {
+		fmt.Fprintln(g.out, "//")
+		g.printDoc("", doc)
+	}
+	if len(outNames) == 0 && retType == "" {
+		fmt.Fprintf(g.out, "func %s%s(%s) {\n", namedMethodReceiver, goFuncName, paramList)
+		fmt.Fprint(g.out, pre)
+		fmt.Fprintf(g.out, "\tC.%s(%s)\n", f.Name, castList)
+		if debugBegin != "" {
+			fmt.Fprintf(g.out, "\t%s\n", debugBegin)
+		}
+	} else if len(outNames) == 0 {
+		fmt.Fprintf(g.out, "func %s%s(%s) %s {\n", namedMethodReceiver, goFuncName, paramList, retType)
+		fmt.Fprint(g.out, pre)
+		if debugBegin != "" {
+			// only paired functions returning bool get here
+			fmt.Fprintf(g.out, "\t_ok := (%s)(C.%s(%s))\n", retType, f.Name, castList)
+			if _, ok := f.Attrs[AttrPairAlways]; ok {
+				fmt.Fprintf(g.out, "\t%s\n", debugBegin)
+			} else {
+				fmt.Fprintf(g.out, "\tif _ok {\n")
+				fmt.Fprintf(g.out, "\t\t%s\n", debugBegin)
+				fmt.Fprintf(g.out, "\t}\n")
+			}
+			fmt.Fprintf(g.out, "\treturn _ok\n")
+		} else if retType[0] >= 'a' && retType[0] <= 'z' {
+			fmt.Fprintf(g.out, "\treturn (%s)(C.%s(%s))\n", retType, f.Name, castList)
 		} else {
-			fmt.Printf("\t_retval := C.%s(%s)\n", f.Name, castList)
-			if strings.HasPrefix(retType, "*") {
-				return fmt.Errorf("pointer return")
+			fmt.Fprintf(g.out, "\t_retval := C.%s(%s)\n", f.Name, castList)
+			fmt.Fprintf(g.out, "\treturn *(*%s)(unsafe.Pointer(&_retval))\n", retType)
+		}
+	} else {
+		// out parameters are returned after the return value, if any
+		var resultTypes, results []string
+		if retType != "" {
+			resultTypes = append(resultTypes, retType)
+			if retType[0] >= 'a' && retType[0] <= 'z' {
+				results = append(results, fmt.Sprintf("(%s)(_retval)", retType))
 			} else {
-				fmt.Printf("\treturn *(*%s)(unsafe.Pointer(&_retval))\n", retType)
+				results = append(results, fmt.Sprintf("*(*%s)(unsafe.Pointer(&_retval))", retType))
 			}
 		}
+		resultTypes = append(resultTypes, outTypes...)
+		results = append(results, outNames...)
+		resultList := resultTypes[0]
+		if len(resultTypes) > 1 {
+			resultList = "(" + strings.Join(resultTypes, ", ") + ")"
+		}
+		fmt.Fprintf(g.out, "func %s%s(%s) %s {\n", namedMethodReceiver, goFuncName, paramList, resultList)
+		fmt.Fprint(g.out, pre)
+		if retType == "" {
+			fmt.Fprintf(g.out, "\tC.%s(%s)\n", f.Name, castList)
+		} else {
+			fmt.Fprintf(g.out, "\t_retval := C.%s(%s)\n", f.Name, castList)
+		}
+		fmt.Fprintf(g.out, "\treturn %s\n", strings.Join(results, ", "))
 	}
-	fmt.Println("}")
+	fmt.Fprintln(g.out, "}")
+	fmt.Fprint(g.out, helper)
 	return nil
 }
+
+// cgoParamExpr returns an expression converting the Go value named goName to
+// the cgo type cgoType.
+func cgoParamExpr(goName, cgoType string, unsafePtr bool) string {
+	var paramFormat string
+	if cgoType == "" {
+		return goName
+	} else if strings.HasPrefix(cgoType, "*C.struct_") || strings.HasPrefix(cgoType, "*") && unsafePtr {
+		paramFormat = "(%s)(unsafe.Pointer(%s))"
+	} else if strings.HasPrefix(cgoType, "C.struct_") {
+		paramFormat = "*(*%s)(unsafe.Pointer(&%s))"
+	} else {
+		paramFormat = "(%s)(%s)"
+	}
+	return fmt.Sprintf(paramFormat, cgoType, goName)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testTarget is the target tests generate for, using its builtin profile so
+// that no C preprocessor is needed.
+var testTarget = Target{GOOS: "linux", GOARCH: "amd64", Builtin: true}
+
+// testHeaderPrelude declares the nuklear types used by test headers.
+const testHeaderPrelude = `typedef _Bool nk_bool;
+typedef unsigned int nk_flags;
+struct nk_context;
+struct nk_rect {float x,y,w,h;};
+`
+
+// testInputs loads the typemap and receiver rules of the repository and the
+// patterns of cfg.
+func testInputs(t *testing.T, cfg *Config) *inputs {
+	t.Helper()
+	in := &inputs{}
+	var err error
+	if in.filePatterns, err = parsePatterns(cfg.Files, DeclFile); err != nil {
+		t.Fatal(err)
+	}
+	if in.enumPatterns, err = parsePatterns(cfg.Enums, DeclEnum); err != nil {
+		t.Fatal(err)
+	}
+	if in.funcPatterns, err = parsePatterns(cfg.Funcs, DeclFunc); err != nil {
+		t.Fatal(err)
+	}
+	if in.structPatterns, err = parsePatterns(cfg.Structs, DeclStruct); err != nil {
+		t.Fatal(err)
+	}
+	if in.typeMap, err = loadTypeMap(TypeMapSource{File: "typemap.csv"}); err != nil {
+		t.Fatal(err)
+	}
+	if in.receivers, err = loadReceiverRules(ReceiverSource{File: "receivers.csv"}); err != nil {
+		t.Fatal(err)
+	}
+	return in
+}
+
+// writeTestHeader writes a header declaring the prelude and src to a
+// temporary directory and returns its path.
+func writeTestHeader(t *testing.T, src string) string {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), "nk.h")
+	if err := os.WriteFile(fileName, []byte(testHeaderPrelude+src), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+// testGenerate generates bindings for the header src with the patterns and
+// options of cfg.
+func testGenerate(t *testing.T, src string, cfg Config, reporting bool) (*generation, error) {
+	t.Helper()
+	cfg.Header = writeTestHeader(t, src)
+	if cfg.Output.Package == "" {
+		cfg.Output.Package = "nk"
+	}
+	return generate(&cfg, testInputs(t, &cfg), testTarget, reporting)
+}
+
+func TestRenamedEnumParam(t *testing.T) {
+	src := `enum nk_heading {NK_UP, NK_RIGHT, NK_DOWN, NK_LEFT};
+void nk_turn(struct nk_context *ctx, enum nk_heading h);
+enum nk_heading nk_heading_of(struct nk_context *ctx, enum nk_heading *h);
+`
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"attribute", Config{
+			Enums: PatternSource{Patterns: []string{"#attrs: name=Direction", "nk_heading"}},
+		}},
+		{"override", Config{
+			Enums: PatternSource{Patterns: []string{"nk_heading"}},
+			Names: map[string]string{"nk_heading": "Direction"},
+		}},
+	}
+	for _, test := range tests {
+		test.cfg.Funcs = PatternSource{Patterns: []string{"nk_turn", "nk_heading_of"}}
+		gen, err := testGenerate(t, src, test.cfg, false)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		output := string(gen.output)
+		for _, want := range []string{
+			"type Direction int32",
+			"func (ctx *Context) Turn(h Direction) {",
+			"func (ctx *Context) HeadingOf(h *Direction) Direction {",
+		} {
+			if !strings.Contains(output, want) {
+				t.Errorf("%s: output does not contain %q:\n%s", test.name, want, output)
+			}
+		}
+		if strings.Contains(output, "Heading)") || strings.Contains(output, "Heading {") {
+			t.Errorf("%s: output refers to the enum by its default name:\n%s", test.name, output)
+		}
+	}
+}
+
+func TestFileFilter(t *testing.T) {
+	dir := t.TempDir()
+	headers := map[string]string{
+		"ext/ext.h":   "#include <stddef.h>\nvoid nk_ext(struct nk_context *ctx, size_t n);\n",
+		"ext/extra.h": "void nk_extra(struct nk_context *ctx);\n",
+	}
+	var extHeaders []string
+	for _, name := range []string{"ext/ext.h", "ext/extra.h"} {
+		fileName := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fileName), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fileName, []byte(headers[name]), 0o666); err != nil {
+			t.Fatal(err)
+		}
+		extHeaders = append(extHeaders, fileName)
+	}
+	tests := []struct {
+		name  string
+		files []string
+		funcs []string
+	}{
+		{"all", nil, []string{"nk_base", "nk_ext", "nk_extra"}},
+		{"base name", []string{`nk\.h`}, []string{"nk_base"}},
+		{"path glob", []string{"glob:*/ext/*"}, []string{"nk_ext", "nk_extra"}},
+		{"negated", []string{".*", `!extra\.h`}, []string{"nk_base", "nk_ext"}},
+		{"exact", []string{"=ext.h", "=" + extHeaders[1]}, []string{"nk_ext", "nk_extra"}},
+	}
+	for _, test := range tests {
+		cfg := Config{
+			Headers: extHeaders,
+			Files:   PatternSource{Patterns: test.files},
+			Funcs:   PatternSource{Patterns: []string{"nk_.*"}},
+		}
+		gen, err := testGenerate(t, "void nk_base(struct nk_context *ctx);\n", cfg, false)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		var funcs []string
+		for _, f := range gen.result.Funcs {
+			funcs = append(funcs, f.Name)
+		}
+		if strings.Join(funcs, ",") != strings.Join(test.funcs, ",") {
+			t.Errorf("%s: got functions %v, want %v", test.name, funcs, test.funcs)
+		}
+	}
+}
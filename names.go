@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/iancoleman/strcase"
+)
+
+// defaultPrefix is stripped from every C name which no other prefix rule
+// applies to.
+const defaultPrefix = "nk_"
+
+// defaultAcronyms are always recognized, in addition to any read from the
+// file given by -acronyms.
+var defaultAcronyms = []string{"HSV", "HSVA", "ID", "RGB", "RGBA", "UTF", "UV"}
+
+// acronyms maps the lowercase form of each known acronym to its canonical
+// form.
+var acronyms = make(map[string]string)
+
+func init() {
+	addAcronyms(defaultAcronyms)
+}
+
+func addAcronyms(list []string) {
+	for _, acronym := range list {
+		acronyms[strings.ToLower(acronym)] = acronym
+	}
+}
+
+// loadAcronyms returns the acronyms from the file of src, if any, followed
+// by its inline acronyms.
+func loadAcronyms(src AcronymSource) ([]string, error) {
+	var list []string
+	if src.File != "" {
+		fileList, err := parseAcronyms(src.File)
+		if err != nil {
+			return nil, fmt.Errorf("parsing file '%s': %w", src.File, err)
+		}
+		list = fileList
+	}
+	for _, acronym := range src.Acronyms {
+		if err := validateAcronym(acronym); err != nil {
+			return nil, err
+		}
+		list = append(list, acronym)
+	}
+	return list, nil
+}
+
+func validateAcronym(acronym string) error {
+	for _, r := range acronym {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return fmt.Errorf("acronym '%s' must contain only letters and digits", acronym)
+		}
+	}
+	return nil
+}
+
+func parseAcronyms(fileName string) ([]string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %w", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	var list []string
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		if err := validateAcronym(line); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		list = append(list, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scanner error: %w", err)
+	}
+	return list, nil
+}
+
+// splitWords splits a C identifier into words at underscores and at
+// transitions from lowercase letters or digits to uppercase letters.
+func splitWords(name string) []string {
+	var words []string
+	start := 0
+	runes := []rune(name)
+	for i, r := range runes {
+		if r == '_' {
+			if i > start {
+				words = append(words, string(runes[start:i]))
+			}
+			start = i + 1
+		} else if i > start && unicode.IsUpper(r) && !unicode.IsUpper(runes[i-1]) {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	if start < len(runes) {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
+
+// acronymWord returns the canonical form of word if it is a known acronym,
+// optionally followed by digits (e.g. "utf8" becomes "UTF8").
+func acronymWord(word string) (string, bool) {
+	letters := strings.TrimRightFunc(word, unicode.IsDigit)
+	if acronym, ok := acronyms[strings.ToLower(letters)]; ok {
+		return acronym + word[len(letters):], true
+	}
+	return "", false
+}
+
+// exportedName converts a C identifier to an exported Go identifier,
+// spelling known acronyms as whole words.
+func exportedName(name string) string {
+	var result strings.Builder
+	for _, word := range splitWords(name) {
+		if acronym, ok := acronymWord(word); ok {
+			result.WriteString(acronym)
+		} else {
+			result.WriteString(strcase.ToCamel(word))
+		}
+	}
+	return result.String()
+}
+
+// unexportedName converts a C identifier to an unexported Go identifier,
+// spelling known acronyms as whole words; an acronym at the start of the
+// name is written in lowercase.
+func unexportedName(name string) string {
+	var result strings.Builder
+	for i, word := range splitWords(name) {
+		if acronym, ok := acronymWord(word); ok && i == 0 {
+			result.WriteString(strings.ToLower(acronym))
+		} else if ok {
+			result.WriteString(acronym)
+		} else if i == 0 {
+			result.WriteString(strcase.ToLowerCamel(word))
+		} else {
+			result.WriteString(strcase.ToCamel(word))
+		}
+	}
+	return result.String()
+}
+
+// PrefixRule describes a prefix which is stripped from the names of C
+// functions before they are converted to Go names.
+type PrefixRule struct {
+	// Receiver is the Go type of the method receiver, e.g. "Color" or
+	// "*Context"; it is empty for rules applying to plain functions.
+	Receiver string `json:"receiver"`
+	// Prefix is the prefix to strip from the C name.
+	Prefix string `json:"prefix"`
+}
+
+// loadPrefixRules returns the rules from the file of src, if any, followed by
+// its inline rules.
+func loadPrefixRules(src PrefixSource) ([]PrefixRule, error) {
+	var rules []PrefixRule
+	if src.File != "" {
+		fileRules, err := parsePrefixRules(src.File)
+		if err != nil {
+			return nil, fmt.Errorf("parsing file '%s': %w", src.File, err)
+		}
+		rules = fileRules
+	}
+	for i, rule := range src.Rules {
+		if rule.Prefix == "" {
+			return nil, fmt.Errorf("inline rule %d: prefix must not be empty", i)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// stripPrefix removes the longest prefix among the rules matching the
+// receiver from the C name, falling back to defaultPrefix.
+func stripPrefix(rules []PrefixRule, receiver, cName string) string {
+	prefix := ""
+	if strings.HasPrefix(cName, defaultPrefix) {
+		prefix = defaultPrefix
+	}
+	for _, rule := range rules {
+		if rule.Receiver != receiver || !strings.HasPrefix(cName, rule.Prefix) {
+			continue
+		}
+		if len(rule.Prefix) > len(prefix) && len(rule.Prefix) < len(cName) {
+			prefix = rule.Prefix
+		}
+	}
+	return strings.TrimPrefix(cName, prefix)
+}
+
+func parsePrefixRules(fileName string) ([]PrefixRule, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %w", err)
+	}
+	defer file.Close()
+	var rules []PrefixRule
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = 2
+	reader.ReuseRecord = true
+	for {
+		record, err := reader.Read()
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("CSV read error: %w", err)
+		} else if len(record) == 0 {
+			break
+		}
+		if record[1] == "" {
+			line, _ := reader.FieldPos(1)
+			return nil, fmt.Errorf("line %d: prefix must not be empty", line)
+		}
+		rules = append(rules, PrefixRule{
+			Receiver: record[0],
+			Prefix:   record[1],
+		})
+	}
+	return rules, nil
+}
+
+// namespace tracks the Go identifiers declared in the generated package so
+// that collisions between generated names can be detected.
+type namespace struct {
+	owners map[string]string
+}
+
+func newNamespace() *namespace {
+	return &namespace{
+		owners: make(map[string]string),
+	}
+}
+
+// declare records that the C declaration described by owner produces the Go
+// identifier name in scope, which is the receiver base type for methods and
+// empty for package-level identifiers.
+func (ns *namespace) declare(scope, name, owner string) error {
+	key := name
+	if scope != "" {
+		key = strings.TrimPrefix(scope, "*") + "." + name
+	}
+	if prev, ok := ns.owners[key]; ok {
+		return fmt.Errorf("Go name %s for %s collides with the one generated for %s", key, owner, prev)
+	}
+	ns.owners[key] = owner
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// nkdebugTag is the build tag which enables the begin/end nesting checks.
+const nkdebugTag = "nkdebug"
+
+// nkdebugSource is the implementation of the nesting checks, which keeps a
+// stack of open scopes per receiver of the begin and end functions.
+const nkdebugSource = `
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// nkdebugScope is a scope opened by a begin function, which must be closed
+// by its end function.
+type nkdebugScope struct {
+	begin, end string
+}
+
+var (
+	nkdebugMu     sync.Mutex
+	nkdebugScopes = make(map[interface{}][]nkdebugScope)
+)
+
+// nkdebugBegin records that begin opened a scope on ctx which end must close.
+func nkdebugBegin(ctx interface{}, begin, end string) {
+	nkdebugMu.Lock()
+	defer nkdebugMu.Unlock()
+	nkdebugScopes[ctx] = append(nkdebugScopes[ctx], nkdebugScope{begin: begin, end: end})
+}
+
+// nkdebugEnd panics unless end closes the innermost scope open on ctx.
+func nkdebugEnd(ctx interface{}, end string) {
+	nkdebugMu.Lock()
+	defer nkdebugMu.Unlock()
+	scopes := nkdebugScopes[ctx]
+	if len(scopes) == 0 {
+		panic(fmt.Sprintf("nkdebug: %s called without a matching begin", end))
+	}
+	if top := scopes[len(scopes)-1]; top.end != end {
+		panic(fmt.Sprintf("nkdebug: %s called, but the innermost open scope was begun by %s and must be "+
+			"ended by %s first", end, top.begin, top.end))
+	}
+	nkdebugScopes[ctx] = scopes[:len(scopes)-1]
+}
+
+// nkdebugDiscard closes the innermost scope open on ctx which end closes,
+// together with the scopes opened inside it, without checking the nesting.
+// It is called instead of nkdebugEnd while a panic unwinds a pair helper, so
+// that a nesting error does not replace the panic.
+func nkdebugDiscard(ctx interface{}, end string) {
+	nkdebugMu.Lock()
+	defer nkdebugMu.Unlock()
+	scopes := nkdebugScopes[ctx]
+	for i := len(scopes) - 1; i >= 0; i-- {
+		if scopes[i].end == end {
+			nkdebugScopes[ctx] = scopes[:i]
+			return
+		}
+	}
+}
+
+// nkdebugEndFrame panics if any scope is open on ctx when frame ends the
+// frame. Hand-written functions ending the frame may call it too.
+func nkdebugEndFrame(ctx interface{}, frame string) {
+	nkdebugMu.Lock()
+	defer nkdebugMu.Unlock()
+	scopes := nkdebugScopes[ctx]
+	if len(scopes) == 0 {
+		return
+	}
+	open := make([]string, len(scopes))
+	for i, scope := range scopes {
+		// innermost first
+		open[len(scopes)-1-i] = fmt.Sprintf("%s (end with %s)", scope.begin, scope.end)
+	}
+	delete(nkdebugScopes, ctx)
+	panic(fmt.Sprintf("nkdebug: %s called with %d open scope(s): %s", frame, len(scopes), strings.Join(open, ", ")))
+}
+`
+
+// nkdebugStubSource replaces the nesting checks when they are disabled.
+const nkdebugStubSource = `
+func nkdebugBegin(ctx interface{}, begin, end string) {}
+
+func nkdebugEnd(ctx interface{}, end string) {}
+
+func nkdebugDiscard(ctx interface{}, end string) {}
+
+func nkdebugEndFrame(ctx interface{}, frame string) {}
+`
+
+// writeNKDebugFiles writes the implementation of the nesting checks and its
+// stub next to the generated file fileName, constrained by the nkdebug build
+// tag and its negation respectively.
+func writeNKDebugFiles(fileName, packageName string) error {
+	ext := filepath.Ext(fileName)
+	stem := strings.TrimSuffix(fileName, ext)
+	files := []struct {
+		name, tag, src string
+	}{
+		{stem + "_" + nkdebugTag + ext, nkdebugTag, nkdebugSource},
+		{stem + "_no" + nkdebugTag + ext, "!" + nkdebugTag, nkdebugStubSource},
+	}
+	for _, file := range files {
+		src := fmt.Sprintf("//go:build %s\n// +build %s\n\n%s\n\npackage %s\n%s", file.tag, file.tag, generatedComment,
+			packageName, file.src)
+		if err := os.WriteFile(file.name, []byte(src), 0o666); err != nil {
+			return fmt.Errorf("writing file '%s': %w", file.name, err)
+		}
+		debugf("wrote nesting checks to file %s", file.name)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestNKDebugEndFrame generates a function with the endframe attribute and
+// runs it, without cgo, against the generated nesting checks.
+func TestNKDebugEndFrame(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs the go command")
+	}
+	receiver := ReceiverRule{CType: "struct nk_context *", Name: "ctx", GoType: "*Context", Expr: "%s.raw()"}
+	if err := receiver.validate(); err != nil {
+		t.Fatal(err)
+	}
+	ctxType, err := parseCType("struct nk_context *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	voidType, err := parseCType("void")
+	if err != nil {
+		t.Fatal(err)
+	}
+	typeMap := newTypeMap()
+	if err := typeMap.add("void", TypeConv{}); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	gen := NewGenerator(&out, typeMap, []ReceiverRule{receiver}, nil, nil)
+	gen.nkdebug = true
+	gen.ends = make(map[string]bool)
+	err = gen.printFunc(FunctionDecl{
+		Name:   "nk_clear",
+		Return: voidType,
+		Params: []FunctionParam{{Name: "ctx", Type: ctxType}},
+		Attrs:  map[string]string{AttrEndFrame: ""},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated := out.String()
+	if !strings.Contains(generated, `nkdebugEndFrame(ctx, "nk_clear")`) {
+		t.Fatalf("generated function does not check the end of the frame:\n%s", generated)
+	}
+	// stand in for cgo
+	generated = strings.ReplaceAll(generated, "C.nk_clear(ctx.raw())", "")
+	output := runNKDebug(t, generated, `
+	ctx := &Context{}
+	ctx.Clear()
+	nkdebugBegin(ctx, "nk_begin", "nk_end")
+	defer func() {
+		fmt.Println(recover())
+	}()
+	ctx.Clear()
+`)
+	want := "nkdebug: nk_clear called with 1 open scope(s): nk_begin (end with nk_end)"
+	if got := strings.TrimSpace(output); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// TestNKDebugPairPanic generates a pair helper and checks that a panic of its
+// closure is not replaced by a nesting error, and that the scopes left open
+// by the closure are closed.
+func TestNKDebugPairPanic(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs the go command")
+	}
+	cfg := Config{
+		Funcs:  PatternSource{Patterns: []string{"#attrs: pair=nk_misc_end", "nk_misc_begin"}},
+		Output: OutputConfig{NKDebug: true},
+	}
+	src := "void nk_misc_begin(struct nk_context *ctx);\nvoid nk_misc_end(struct nk_context *ctx);\n"
+	gen, err := testGenerate(t, src, cfg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated := string(gen.output)
+	generated = generated[strings.Index(generated, "\n// MiscBegin"):]
+	// stand in for cgo
+	generated = regexp.MustCompile(`C\.nk_misc_(?:begin|end)\(ctx\.raw\(\)\)`).ReplaceAllString(generated, "")
+	output := runNKDebug(t, generated, `
+	ctx := &Context{}
+	func() {
+		defer func() {
+			fmt.Println(recover())
+		}()
+		ctx.Misc(func() {
+			nkdebugBegin(ctx, "nk_inner_begin", "nk_inner_end")
+			panic("closure panicked")
+		})
+	}()
+	nkdebugEndFrame(ctx, "nk_clear")
+	ctx.Misc(func() {})
+	fmt.Println("done")
+`)
+	want := "closure panicked\ndone"
+	if got := strings.TrimSpace(output); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// runNKDebug runs the body of main, without cgo, with the generated code
+// and the nesting checks, and returns its output.
+func runNKDebug(t *testing.T, generated, mainBody string) string {
+	t.Helper()
+	dir := t.TempDir()
+	mainSource := `package main
+
+import "fmt"
+
+type Context struct{}
+` + generated + `
+func main() {` + mainBody + `}
+`
+	files := map[string]string{
+		"go.mod":     "module nkdebugtest\n\ngo 1.17\n",
+		"main.go":    mainSource,
+		"nkdebug.go": "package main\n" + nkdebugSource,
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=", "GOWORK=off", "CGO_ENABLED=0")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("running generated code: %v\n%s", err, output)
+	}
+	return string(output)
+}
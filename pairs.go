@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// beginFunc describes the Go function generated for a C function with the
+// pair attribute.
+type beginFunc struct {
+	decl   FunctionDecl
+	goName string
+	// receiver is the receiver rule of the function if it is a method.
+	receiver *ReceiverRule
+	// params are the Go parameters, each written as "name type".
+	params []string
+	// result is the Go result type, which is empty or bool.
+	result string
+	// firstCParam is the cgo expression passed as the receiver to C, if the
+	// function is a method.
+	firstCParam string
+}
+
+// pairHelper returns the source of the closure-style helper which calls the
+// begin function, the closure and the end function named by the pair
+// attribute. The end function must take no parameters or only the receiver
+// of the begin function.
+func (g *Generator) pairHelper(begin beginFunc) (string, error) {
+	f := begin.decl
+	end := f.End
+	if begin.result != "" && begin.result != "bool" {
+		return "", fmt.Errorf("paired function must return bool or nothing, not %s", begin.result)
+	}
+	if len(end.Params) > 1 || len(end.Params) == 1 && (begin.receiver == nil ||
+		end.Params[0].Type.Key() != f.Params[0].Type.Key()) {
+		return "", fmt.Errorf("end function %s must take no parameters or only the receiver of %s", end.Name, f.Name)
+	}
+	_, always := f.Attrs[AttrPairAlways]
+	if always && begin.result == "" {
+		return "", fmt.Errorf("attribute %s requires %s to return bool", AttrPairAlways, f.Name)
+	}
+	helperName, ok := f.Attrs[AttrPairName]
+	if !ok {
+		helperName = strings.Replace(begin.goName, "Begin", "", 1)
+		if helperName == begin.goName || helperName == "" {
+			return "", fmt.Errorf("cannot derive name of pair helper from %s (set attr %s)", begin.goName, AttrPairName)
+		}
+	}
+	helperName = exportedName(helperName)
+	receiverType, caller := "", ""
+	if begin.receiver != nil {
+		receiverType = begin.receiver.GoType
+		caller = begin.receiver.Name + "."
+	}
+	if err := g.names.declare(receiverType, helperName, "pair helper of function "+f.Name); err != nil {
+		return "", err
+	}
+	bodyName := "body"
+	args := make([]string, len(begin.params))
+	for i, param := range begin.params {
+		args[i] = strings.Fields(param)[0]
+		if args[i] == bodyName {
+			bodyName = "fn"
+		}
+	}
+	endArgs := ""
+	if len(end.Params) == 1 {
+		endArgs = begin.firstCParam
+	}
+	beginCall := fmt.Sprintf("%s%s(%s)", caller, begin.goName, strings.Join(args, ", "))
+	endCall := fmt.Sprintf("C.%s(%s)", end.Name, endArgs)
+	// deferEnd defers the end call and bodyDone follows the call of the
+	// closure; both are indented by the caller
+	deferEnd, bodyDone := "defer "+endCall+"\n", ""
+	if g.nkdebug {
+		// the end function is called from C, so the nesting check must be
+		// made here; it is skipped while the closure panics, so as not to
+		// replace that panic with a nesting error
+		debugKey := "nil"
+		if begin.receiver != nil {
+			debugKey = begin.receiver.Name
+		}
+		deferEnd = fmt.Sprintf("_panicked := true\n"+
+			"defer func() {\n"+
+			"\tif _panicked {\n"+
+			"\t\tnkdebugDiscard(%[1]s, %[2]q)\n"+
+			"\t} else {\n"+
+			"\t\tnkdebugEnd(%[1]s, %[2]q)\n"+
+			"\t}\n"+
+			"\t%[3]s\n"+
+			"}()\n", debugKey, end.Name, endCall)
+		bodyDone = "_panicked = false\n"
+	}
+	params := strings.Join(append(begin.params, bodyName+" func()"), ", ")
+	methodReceiver := ""
+	if begin.receiver != nil {
+		methodReceiver = fmt.Sprintf("(%s %s) ", begin.receiver.Name, begin.receiver.GoType)
+	}
+	var src strings.Builder
+	fmt.Fprintln(&src)
+	switch {
+	case begin.result == "":
+		fmt.Fprintf(&src, "// %s calls %s, %s and then %s, even if %s panics.\n", helperName, begin.goName, bodyName,
+			end.Name, bodyName)
+		fmt.Fprintf(&src, "func %s%s(%s) {\n", methodReceiver, helperName, params)
+		fmt.Fprintf(&src, "\t%s\n", beginCall)
+		fmt.Fprint(&src, indent(deferEnd))
+		fmt.Fprintf(&src, "\t%s()\n", bodyName)
+		fmt.Fprint(&src, indent(bodyDone))
+	case always:
+		fmt.Fprintf(&src, "// %s calls %s, %s if %s returns true, and then %s, even if %s panics.\n",
+			helperName, begin.goName, bodyName, begin.goName, end.Name, bodyName)
+		fmt.Fprintf(&src, "// It returns the result of %s.\n", begin.goName)
+		fmt.Fprintf(&src, "func %s%s(%s) bool {\n", methodReceiver, helperName, params)
+		fmt.Fprintf(&src, "\t_ok := %s\n", beginCall)
+		fmt.Fprint(&src, indent(deferEnd))
+		fmt.Fprintf(&src, "\tif _ok {\n")
+		fmt.Fprintf(&src, "\t\t%s()\n", bodyName)
+		fmt.Fprintf(&src, "\t}\n")
+		fmt.Fprint(&src, indent(bodyDone))
+		fmt.Fprintf(&src, "\treturn _ok\n")
+	default:
+		fmt.Fprintf(&src, "// %s calls %s and, if it returns true, %s and then %s, even if %s panics.\n",
+			helperName, begin.goName, bodyName, end.Name, bodyName)
+		fmt.Fprintf(&src, "// It returns the result of %s.\n", begin.goName)
+		fmt.Fprintf(&src, "func %s%s(%s) bool {\n", methodReceiver, helperName, params)
+		fmt.Fprintf(&src, "\tif !%s {\n", beginCall)
+		fmt.Fprintf(&src, "\t\treturn false\n")
+		fmt.Fprintf(&src, "\t}\n")
+		fmt.Fprint(&src, indent(deferEnd))
+		fmt.Fprintf(&src, "\t%s()\n", bodyName)
+		fmt.Fprint(&src, indent(bodyDone))
+		fmt.Fprintf(&src, "\treturn true\n")
+	}
+	fmt.Fprintln(&src, "}")
+	return src.String(), nil
+}
+
+// indent indents every line of src by one tab.
+func indent(src string) string {
+	if src == "" {
+		return ""
+	}
+	return "\t" + strings.ReplaceAll(strings.TrimSuffix(src, "\n"), "\n", "\n\t") + "\n"
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPairHelpers(t *testing.T) {
+	src := `nk_bool nk_begin(struct nk_context *ctx, const char *title, struct nk_rect bounds, nk_flags flags);
+void nk_end(struct nk_context *ctx);
+nk_bool nk_group_begin(struct nk_context *ctx, const char *title, int len, nk_flags flags);
+void nk_group_end(struct nk_context *ctx);
+void nk_layout_row_template_begin(struct nk_context *ctx, float height);
+void nk_layout_row_template_end(struct nk_context *ctx);
+void nk_misc_begin(void);
+void nk_misc_end(void);
+int nk_count_begin(struct nk_context *ctx);
+void nk_count_end(struct nk_context *ctx);
+void nk_wide_begin(struct nk_context *ctx);
+void nk_wide_end(struct nk_context *ctx, float width);
+`
+	tests := []struct {
+		name    string
+		funcs   []string
+		nkdebug bool
+		want    []string
+		err     string
+	}{
+		{
+			name:  "void",
+			funcs: []string{"#attrs: pair=nk_layout_row_template_end", "nk_layout_row_template_begin"},
+			want: []string{
+				"func (ctx *Context) LayoutRowTemplate(height float32, body func()) {\n" +
+					"\tctx.LayoutRowTemplateBegin(height)\n" +
+					"\tdefer C.nk_layout_row_template_end(ctx.raw())\n" +
+					"\tbody()\n" +
+					"}\n",
+			},
+		},
+		{
+			name:  "bool",
+			funcs: []string{"#attrs: pair=nk_group_end", "nk_group_begin"},
+			want: []string{
+				"func (ctx *Context) Group(title string, flags Flags, body func()) bool {\n" +
+					"\tif !ctx.GroupBegin(title, flags) {\n" +
+					"\t\treturn false\n" +
+					"\t}\n" +
+					"\tdefer C.nk_group_end(ctx.raw())\n" +
+					"\tbody()\n" +
+					"\treturn true\n" +
+					"}\n",
+			},
+		},
+		{
+			name:  "always",
+			funcs: []string{"#attrs: pair=nk_end,pairalways,pairname=Window,nostrlen", "nk_begin"},
+			want: []string{
+				"func (ctx *Context) Window(title string, bounds Rect, flags Flags, body func()) bool {\n" +
+					"\t_ok := ctx.Begin(title, bounds, flags)\n" +
+					"\tdefer C.nk_end(ctx.raw())\n" +
+					"\tif _ok {\n" +
+					"\t\tbody()\n" +
+					"\t}\n" +
+					"\treturn _ok\n" +
+					"}\n",
+			},
+		},
+		{
+			name:  "function",
+			funcs: []string{"#attrs: pair=nk_misc_end", "nk_misc_begin"},
+			want:  []string{"func Misc(body func()) {\n\tMiscBegin()\n\tdefer C.nk_misc_end()\n"},
+		},
+		{
+			name:    "nkdebug",
+			funcs:   []string{"#attrs: pair=nk_group_end", "nk_group_begin", "#attrs:", "nk_group_end"},
+			nkdebug: true,
+			want: []string{
+				"\t\tnkdebugBegin(ctx, \"nk_group_begin\", \"nk_group_end\")\n",
+				"func (ctx *Context) GroupEnd() {\n\tnkdebugEnd(ctx, \"nk_group_end\")\n",
+			},
+		},
+		{
+			name:  "not bool",
+			funcs: []string{"#attrs: pair=nk_count_end", "nk_count_begin"},
+			err:   "paired function must return bool or nothing",
+		},
+		{
+			name:  "end parameters",
+			funcs: []string{"#attrs: pair=nk_wide_end", "nk_wide_begin"},
+			err:   "end function nk_wide_end must take no parameters or only the receiver",
+		},
+		{
+			name:  "always without bool",
+			funcs: []string{"#attrs: pair=nk_misc_end,pairalways", "nk_misc_begin"},
+			err:   "attribute pairalways requires nk_misc_begin to return bool",
+		},
+		{
+			name:  "no name",
+			funcs: []string{"#attrs: pair=nk_end,nostrlen", "nk_begin"},
+			err:   "cannot derive name of pair helper from Begin",
+		},
+		{
+			name:  "undeclared end",
+			funcs: []string{"#attrs: pair=nk_misc_stop", "nk_misc_begin"},
+			err:   "end function nk_misc_stop paired with function nk_misc_begin is not declared",
+		},
+		{
+			name:  "always without pair",
+			funcs: []string{"#attrs: pairalways", "nk_group_begin"},
+			err:   "attribute pairalways requires attribute pair",
+		},
+	}
+	for _, test := range tests {
+		cfg := Config{
+			Funcs:  PatternSource{Patterns: test.funcs},
+			Output: OutputConfig{NKDebug: test.nkdebug},
+		}
+		gen, err := testGenerate(t, src, cfg, false)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want one containing %q", test.name, err, test.err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		for _, want := range test.want {
+			if !strings.Contains(string(gen.output), want) {
+				t.Errorf("%s: output does not contain %q:\n%s", test.name, want, gen.output)
+			}
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"path/filepath"
 	"sort"
 
 	"modernc.org/cc/v3"
@@ -11,20 +12,39 @@ const Anonymous = "(anonymous)"
 
 type EnumDecl struct {
 	Name      string
-	Constants []string
+	Constants []EnumConstant
 	Attrs     map[string]string
+	// Doc is the comment documenting the enum in the header, if any.
+	Doc string
+	// Deprecated is the message with which the header marks the enum
+	// deprecated, or empty if it does not.
+	Deprecated string
+}
+
+type EnumConstant struct {
+	Name       string
+	Doc        string
+	Deprecated string
 }
 
 type FunctionDecl struct {
 	Name   string
-	Return string
+	Return CType
 	Params []FunctionParam
 	Attrs  map[string]string
+	// Doc is the comment documenting the function in the header, if any.
+	Doc string
+	// Deprecated is the message with which the header marks the function
+	// deprecated, or empty if it does not.
+	Deprecated string
+	// End is the declaration of the function named by the pair attribute,
+	// whether or not it is matched itself.
+	End *FunctionDecl
 }
 
 type FunctionParam struct {
 	Name string
-	Type string
+	Type CType
 }
 
 type StructDecl struct {
@@ -35,79 +55,215 @@ type StructDecl struct {
 
 type StructMember struct {
 	Name string
-	Type string
+	Type CType
+}
+
+// DeclKind identifies the kind of a C declaration.
+type DeclKind string
+
+const (
+	DeclEnum   DeclKind = "enum"
+	DeclFunc   DeclKind = "function"
+	DeclStruct DeclKind = "struct"
+	// DeclParam is not a declaration in its own right, but identifies
+	// attributes which apply to function parameters.
+	DeclParam DeclKind = "parameter"
+	// DeclFile is not a declaration either, but identifies patterns which
+	// are matched against the paths of the headers declaring symbols.
+	DeclFile DeclKind = "file"
+)
+
+// DeclRef identifies a named C declaration found in the header.
+type DeclRef struct {
+	Kind DeclKind
+	Name string
+}
+
+// MatchDecision describes whether and why a declaration was included.
+type MatchDecision struct {
+	Include bool
+	Attrs   map[string]string
+	// Pattern is the last pattern which matched the declaration, if any.
+	Pattern *Pattern
+	// Matched lists every pattern which matched the declaration, in order.
+	Matched []*Pattern
+	// Existing describes the hand-written Go binding of the declaration, if
+	// one exists.
+	Existing string
 }
 
 type Matcher interface {
+	// MatchFile reports whether declarations in the named header are
+	// considered at all.
+	MatchFile(fileName string) bool
 	MatchEnum(name string) (attrs map[string]string, ok bool)
 	MatchFunc(name string) (attrs map[string]string, ok bool)
 	MatchStruct(name string) (attrs map[string]string, ok bool)
+	// Decide is like the Match methods but explains the decision and has no
+	// side effects such as logging.
+	Decide(kind DeclKind, name string) MatchDecision
+	// DeadPatterns returns the patterns which have not matched any name
+	// passed to the Match methods so far.
+	DeadPatterns() []*Pattern
 }
 
 type patternMatcher struct {
+	filePatterns   []Pattern
 	enumPatterns   []Pattern
 	funcPatterns   []Pattern
 	structPatterns []Pattern
+	hits           map[*Pattern]int
+}
+
+func (m *patternMatcher) MatchFile(fileName string) bool {
+	if len(m.filePatterns) == 0 {
+		return true
+	}
+	_, ok := m.match(DeclFile, fileName)
+	return ok
 }
 
 func (m *patternMatcher) MatchEnum(name string) (attrs map[string]string, ok bool) {
-	return m.match("enum", name, m.enumPatterns)
+	return m.match(DeclEnum, name)
 }
 
 func (m *patternMatcher) MatchFunc(name string) (attrs map[string]string, ok bool) {
-	return m.match("function", name, m.funcPatterns)
+	return m.match(DeclFunc, name)
 }
 
 func (m *patternMatcher) MatchStruct(name string) (attrs map[string]string, ok bool) {
-	return m.match("struct", name, m.structPatterns)
+	return m.match(DeclStruct, name)
 }
 
-func (m *patternMatcher) match(what, name string, patterns []Pattern) (attrs map[string]string, ok bool) {
-	if len(patterns) == 0 {
-		return nil, false
+func (m *patternMatcher) match(kind DeclKind, name string) (attrs map[string]string, ok bool) {
+	decision := m.decide(kind, name, func(pattern *Pattern) {
+		m.hits[pattern]++
+	})
+	if decision.Pattern == nil {
+		debugf("excluding %s %s because no patterns matched it", kind, name)
+	} else if decision.Include {
+		debugf("including %s %s because of pattern '%s' at %s", kind, name, decision.Pattern.Text,
+			decision.Pattern.Location())
+	} else {
+		debugf("excluding %s %s because of negated pattern '%s' at %s", kind, name, decision.Pattern.Text,
+			decision.Pattern.Location())
 	}
-	include := false
-	anyMatch := false
-	for _, pattern := range patterns {
-		if match := pattern.Regexp.FindString(name); match == name {
-			if pattern.Negate {
-				include = false
-				anyMatch = true
-				debugf("excluding %s %s because of negated pattern '%s'", what, name, pattern.Regexp)
-			} else {
-				include = true
-				anyMatch = true
-				debugf("including %s %s because of pattern '%s'", what, name, pattern.Regexp)
-				if len(pattern.Attrs) != 0 && attrs == nil {
-					attrs = make(map[string]string)
-				}
-				for key, value := range pattern.Attrs {
-					attrs[key] = value
-				}
-			}
+	return decision.Attrs, decision.Include
+}
+
+func (m *patternMatcher) patterns(kind DeclKind) []Pattern {
+	switch kind {
+	case DeclFile:
+		return m.filePatterns
+	case DeclEnum:
+		return m.enumPatterns
+	case DeclFunc:
+		return m.funcPatterns
+	case DeclStruct:
+		return m.structPatterns
+	}
+	return nil
+}
+
+func (m *patternMatcher) Decide(kind DeclKind, name string) MatchDecision {
+	return m.decide(kind, name, nil)
+}
+
+// decide computes the decision for name, calling visit (if not nil) for
+// every pattern which matches it.
+func (m *patternMatcher) decide(kind DeclKind, name string, visit func(pattern *Pattern)) MatchDecision {
+	var decision MatchDecision
+	patterns := m.patterns(kind)
+	if kind == DeclFile && len(patterns) == 0 {
+		// without file patterns, every header is considered
+		decision.Include = true
+		return decision
+	}
+	for i := range patterns {
+		pattern := &patterns[i]
+		if !pattern.Match(name) && (kind != DeclFile || !pattern.Match(filepath.Base(name))) {
+			continue
+		}
+		if visit != nil {
+			visit(pattern)
+		}
+		decision.Pattern = pattern
+		decision.Matched = append(decision.Matched, pattern)
+		if pattern.Negate {
+			decision.Include = false
+			continue
+		}
+		decision.Include = true
+		if len(pattern.Attrs) != 0 && decision.Attrs == nil {
+			decision.Attrs = make(map[string]string)
+		}
+		for key, value := range pattern.Attrs {
+			decision.Attrs[key] = value
 		}
 	}
-	if !anyMatch {
-		debugf("excluding %s %s because no patterns matched it", what, name)
+	return decision
+}
+
+func (m *patternMatcher) DeadPatterns() []*Pattern {
+	var dead []*Pattern
+	for _, kind := range []DeclKind{DeclFile, DeclEnum, DeclFunc, DeclStruct} {
+		patterns := m.patterns(kind)
+		for i := range patterns {
+			if m.hits[&patterns[i]] == 0 {
+				dead = append(dead, &patterns[i])
+			}
+		}
 	}
-	return attrs, include
+	return dead
 }
 
-func NewPatternMatcher(enumPatterns, funcPatterns, structPatterns []Pattern) Matcher {
+func NewPatternMatcher(filePatterns, enumPatterns, funcPatterns, structPatterns []Pattern) Matcher {
 	return &patternMatcher{
+		filePatterns:   filePatterns,
 		enumPatterns:   enumPatterns,
 		funcPatterns:   funcPatterns,
 		structPatterns: structPatterns,
+		hits:           make(map[*Pattern]int),
 	}
 }
 
+// ParseOptions configures how the C preprocessor and parser are run.
+type ParseOptions struct {
+	// CPP is the path to the C preprocessor used to obtain the host
+	// configuration.
+	CPP string
+	// IncludePaths are appended to the host include paths.
+	IncludePaths []string
+	// Predefined is C source, usually macro definitions, appended to the
+	// host predefined macros.
+	Predefined string
+	// GOOS and GOARCH select the target ABI; if they are empty, the ABI is
+	// given by the GOOS and GOARCH environment variables or the host.
+	GOOS   string
+	GOARCH string
+	// TargetPredefined, if not empty, is C source which replaces the host
+	// predefined macros.
+	TargetPredefined string
+	// Builtin parses against the bundled libc headers instead of asking the
+	// C preprocessor for the host configuration, so that no C toolchain is
+	// needed; TargetPredefined must then hold the target's predefined macros.
+	Builtin bool
+	// KeepGoing records the errors of matched declarations which cannot be
+	// bound in ParseResult.Failures, instead of failing at the first one.
+	KeepGoing bool
+}
+
 type Parser struct {
 	matcher Matcher
+	opts    ParseOptions
+	docs    *docReader
 }
 
-func NewParser(matcher Matcher) *Parser {
+func NewParser(matcher Matcher, opts ParseOptions) *Parser {
 	return &Parser{
 		matcher: matcher,
+		opts:    opts,
+		docs:    newDocReader(),
 	}
 }
 
@@ -115,34 +271,89 @@ type ParseResult struct {
 	Enums   []EnumDecl
 	Funcs   []FunctionDecl
 	Structs []StructDecl
+	// Decls lists every named declaration found, whether matched or not,
+	// including those in headers excluded by the file patterns.
+	Decls []DeclRef
+	// Files maps each of Decls to the name of the file declaring it.
+	Files map[DeclRef]string
+	// Failures holds the errors of matched declarations which cannot be
+	// bound; it is only filled in with ParseOptions.KeepGoing.
+	Failures map[DeclRef]error
 }
 
-func (p *Parser) Parse(fileName string) (ParseResult, error) {
-	debug("determing host configuration from C preprocessor")
-	predefined, includePaths, sysIncludePaths, err := cc.HostConfig(*flagCPP)
-	if err != nil {
-		return ParseResult{}, fmt.Errorf("obtaining host configuration: %w", err)
+// Parse parses and type checks the named headers, in order, as a single
+// translation unit for the target ABI.
+func (p *Parser) Parse(fileNames []string) (ParseResult, error) {
+	cfg := &cc.Config{}
+	var predefined string
+	var includePaths, sysIncludePaths []string
+	var err error
+	if p.opts.Builtin {
+		debug("using builtin target profile and libc headers")
+		sysIncludePaths = []string{builtinIncludeDir}
+		cfg.Filesystem = builtinFilesystem()
+	} else {
+		debug("determing host configuration from C preprocessor")
+		predefined, includePaths, sysIncludePaths, err = cc.HostConfig(p.opts.CPP)
+		if err != nil {
+			return ParseResult{}, fmt.Errorf("obtaining host configuration: %w", err)
+		}
+	}
+	if p.opts.TargetPredefined != "" {
+		debug("replacing host predefined macros with target predefined macros")
+		predefined = p.opts.TargetPredefined
+	}
+	if p.opts.Predefined != "" {
+		debugf("appending %s to predefined", p.opts.Predefined)
+		predefined += "\n" + p.opts.Predefined
 	}
 	debugf("predefined = %s", predefined)
+	// like a C compiler, search the directory of the including file first for
+	// quoted includes, so that an extension header can include nuklear
+	includePaths = append([]string{"@"}, includePaths...)
 	debugf("includePaths = %v", includePaths)
 	debugf("sysIncludePaths = %v", sysIncludePaths)
-	if *flagInclude != "" {
-		debugf("appending %s to includePaths", *flagInclude)
-		includePaths = append(includePaths, *flagInclude)
+	if len(p.opts.IncludePaths) != 0 {
+		debugf("appending %v to includePaths", p.opts.IncludePaths)
+		includePaths = append(includePaths, p.opts.IncludePaths...)
 	}
 	sources := []cc.Source{
 		{Name: "__predefined__", Value: predefined},
-		{Name: fileName},
 	}
-	debugf("parsing file %s", fileName)
-	cfg := &cc.Config{}
-	ast, err := cc.Parse(cfg, includePaths, sysIncludePaths, sources)
+	for _, fileName := range fileNames {
+		sources = append(sources, cc.Source{Name: fileName})
+	}
+	if p.opts.GOOS != "" {
+		cfg.ABI, err = cc.NewABI(p.opts.GOOS, p.opts.GOARCH)
+	} else {
+		cfg.ABI, err = cc.NewABIFromEnv()
+	}
+	if err != nil {
+		return ParseResult{}, fmt.Errorf("determining target ABI: %w", err)
+	}
+	debugf("parsing and type checking files %v", fileNames)
+	ast, err := cc.Translate(cfg, includePaths, sysIncludePaths, sources)
 	if err != nil {
 		return ParseResult{}, fmt.Errorf("parsing sources: %w", err)
 	}
 	var enums []EnumDecl
 	var funcs []FunctionDecl
 	var structs []StructDecl
+	var decls []DeclRef
+	declFiles := make(map[DeclRef]string)
+	failures := make(map[DeclRef]error)
+	// files caches whether declarations in each file are considered
+	files := make(map[string]bool)
+	// protos holds every function declaration with a resolved type, so that
+	// end functions can be found for pair attributes
+	protos := make(map[string]FunctionDecl)
+	addDecl := func(kind DeclKind, name, fileName string) {
+		ref := DeclRef{Kind: kind, Name: name}
+		if _, seen := declFiles[ref]; name != "" && name != Anonymous && !seen {
+			declFiles[ref] = fileName
+			decls = append(decls, ref)
+		}
+	}
 	// translation_unit
 	//   : external_declaration
 	//   | translation_unit external_declaration
@@ -157,6 +368,12 @@ func (p *Parser) Parse(fileName string) (ParseResult, error) {
 			// function definition, not mere declaration
 			continue
 		}
+		fileName := decln.Position().Filename
+		matchFile, ok := files[fileName]
+		if !ok {
+			matchFile = p.matcher.MatchFile(fileName)
+			files[fileName] = matchFile
+		}
 		// declaration
 		//   : declaration_specifiers ';'
 		//   | declaration_specifiers init_declarator_list ';'
@@ -175,6 +392,12 @@ func (p *Parser) Parse(fileName string) (ParseResult, error) {
 			//   ;
 			for ds := decln.DeclarationSpecifiers; ds != nil; ds = ds.DeclarationSpecifiers {
 				if ts := ds.TypeSpecifier; ts != nil && ts.Case == cc.TypeSpecifierEnum {
+					if es := ts.EnumSpecifier; es.Case == cc.EnumSpecifierDef {
+						addDecl(DeclEnum, es.Token2.String(), fileName)
+					}
+					if !matchFile {
+						continue
+					}
 					enumDecl, err := p.parseEnum(decln)
 					if err != nil {
 						return ParseResult{}, fmt.Errorf("parsing enum at position %s: %w", tu.Position(), err)
@@ -183,6 +406,12 @@ func (p *Parser) Parse(fileName string) (ParseResult, error) {
 						enums = append(enums, enumDecl)
 					}
 				} else if ts != nil && ts.Case == cc.TypeSpecifierStructOrUnion {
+					if sus := ts.StructOrUnionSpecifier; sus.StructOrUnion.Case == cc.StructOrUnionStruct {
+						addDecl(DeclStruct, sus.Token.String(), fileName)
+					}
+					if !matchFile {
+						continue
+					}
 					structDecl, err := p.parseStruct(decln)
 					if err != nil {
 						return ParseResult{}, fmt.Errorf("parsing struct at position %s: %w", tu.Position(), err)
@@ -225,54 +454,103 @@ func (p *Parser) Parse(fileName string) (ParseResult, error) {
 		//   | direct_declarator '(' identifier_list ')'
 		//   | direct_declarator '(' ')'
 		//   ;
-		var params []FunctionParam
-		var attrs map[string]string
-		ddecl := decl.DirectDeclarator
-		switch ddecl.Case {
-		case cc.DirectDeclaratorFuncParam:
-			debugf("found function %s at %s", decl.Name(), decl.Position())
-			var ok bool
-			if attrs, ok = p.matcher.MatchFunc(decl.Name().String()); !ok {
-				continue
-			}
-			// parameter_type_list
-			//   : parameter_list
-			//   | parameter_list ',' ELLIPSIS
-			//   ;
-			switch ddecl.ParameterTypeList.Case {
-			case cc.ParameterTypeListList:
-				params, err = makeFuncParams(ddecl.ParameterTypeList.ParameterList)
-				if err != nil {
-					return ParseResult{}, fmt.Errorf("cannot resolve parameters for function %s: %w", decl.Name(), err)
-				}
-			case cc.ParameterTypeListVar:
-				return ParseResult{}, fmt.Errorf("function %s requires varargs support", decl.Name())
-			}
-		default:
+		if decl.DirectDeclarator.Case != cc.DirectDeclaratorFuncParam {
 			debugf("ignoring non-function declaration %s at %s", decl.Name(), decl.Position())
 			continue
 		}
-		returnType, err := returnTypeName(decln.DeclarationSpecifiers, decl.Pointer)
-		if err != nil {
-			return ParseResult{}, fmt.Errorf("cannot resolve return type for function %s: %w", decl.Name(), err)
+		// errors are only reported for matched functions
+		funcType, typeErr := functionType(decln.DeclarationSpecifiers, decl)
+		if typeErr == nil && (funcType.Kind != CTypeFunc || len(funcType.Pointers) != 0) {
+			debugf("ignoring function pointer declaration %s at %s", decl.Name(), decl.Position())
+			continue
+		}
+		if typeErr == nil {
+			setLayout(&funcType, decl.Type())
 		}
+		debugf("found function %s at %s", decl.Name(), decl.Position())
+		addDecl(DeclFunc, decl.Name().String(), fileName)
+		if !matchFile {
+			continue
+		}
+		if typeErr == nil {
+			protos[decl.Name().String()] = FunctionDecl{
+				Name:   decl.Name().String(),
+				Return: funcType.Func.Return,
+				Params: funcType.Func.Params,
+			}
+		}
+		attrs, ok := p.matcher.MatchFunc(decl.Name().String())
+		if !ok {
+			continue
+		}
+		var funcErr error
+		if typeErr != nil {
+			funcErr = fmt.Errorf("cannot resolve type of function %s: %w", decl.Name(), typeErr)
+		} else if funcType.Func.Variadic {
+			funcErr = fmt.Errorf("function %s requires varargs support", decl.Name())
+		}
+		if funcErr != nil && p.opts.KeepGoing {
+			failures[DeclRef{Kind: DeclFunc, Name: decl.Name().String()}] = funcErr
+			continue
+		} else if funcErr != nil {
+			return ParseResult{}, funcErr
+		}
+		pos := decln.Position()
+		doc := p.docs.leading(pos.Filename, pos.Line)
+		declAttrs := append(specifierAttrs(decln.DeclarationSpecifiers), decl.AttributeSpecifierList,
+			idecl.AttributeSpecifierList)
 		funcs = append(funcs, FunctionDecl{
-			Name:   decl.Name().String(),
-			Return: returnType,
-			Params: params,
-			Attrs:  attrs,
+			Name:       decl.Name().String(),
+			Return:     funcType.Func.Return,
+			Params:     funcType.Func.Params,
+			Attrs:      attrs,
+			Doc:        doc,
+			Deprecated: p.deprecation(decl.Name().String(), declAttrs, pos.Filename, pos.Line, decl.Position().Line, doc),
 		})
 	}
+	paired := funcs[:0]
+	for _, f := range funcs {
+		endName, ok := f.Attrs[AttrPair]
+		if !ok {
+			paired = append(paired, f)
+			continue
+		}
+		end, ok := protos[endName]
+		if !ok {
+			err := fmt.Errorf("end function %s paired with function %s is not declared", endName, f.Name)
+			if !p.opts.KeepGoing {
+				return ParseResult{}, err
+			}
+			failures[DeclRef{Kind: DeclFunc, Name: f.Name}] = err
+			continue
+		}
+		f.End = &end
+		paired = append(paired, f)
+	}
+	funcs = paired
 	sort.Slice(funcs, func(i, j int) bool {
 		return funcs[i].Name < funcs[j].Name
 	})
 	return ParseResult{
-		Enums:   enums,
-		Funcs:   funcs,
-		Structs: structs,
+		Enums:    enums,
+		Funcs:    funcs,
+		Structs:  structs,
+		Decls:    decls,
+		Files:    declFiles,
+		Failures: failures,
 	}, nil
 }
 
+// functionType returns the type declared by a function declarator.
+func functionType(declSpec *cc.DeclarationSpecifiers, decl *cc.Declarator) (CType, error) {
+	baseType, err := cTypeOfSpecifiers(declSpec)
+	if err != nil {
+		return CType{}, fmt.Errorf("resolving return type: %w", err)
+	}
+	funcType, _, err := declaratorType(baseType, decl)
+	return funcType, err
+}
+
 func (p *Parser) parseEnum(decln *cc.Declaration) (EnumDecl, error) {
 	// enum_specifier
 	//   : ENUM '{' enumerator_list '}'
@@ -304,14 +582,30 @@ func (p *Parser) parseEnum(decln *cc.Declaration) (EnumDecl, error) {
 			//   : IDENTIFIER
 			//   | IDENTIFIER '=' constant_expression
 			//   ;
-			var constants []string
+			var constants []EnumConstant
 			for el := es.EnumeratorList; el != nil; el = el.EnumeratorList {
-				constants = append(constants, el.Enumerator.Token.String())
+				// prefer a comment trailing the enumerator to one before it
+				pos := el.Enumerator.Token.Position()
+				doc := p.docs.trailing(pos.Filename, pos.Line, pos.Column+len(el.Enumerator.Token.String()))
+				if doc == "" {
+					doc = p.docs.leading(pos.Filename, pos.Line)
+				}
+				constants = append(constants, EnumConstant{
+					Name: el.Enumerator.Token.String(),
+					Doc:  doc,
+					Deprecated: p.deprecation(el.Enumerator.Token.String(),
+						[]*cc.AttributeSpecifierList{el.Enumerator.AttributeSpecifierList}, pos.Filename, pos.Line,
+						pos.Line, doc),
+				})
 			}
+			pos := es.Position()
+			doc := p.docs.leading(pos.Filename, pos.Line)
 			return EnumDecl{
-				Name:      name,
-				Constants: constants,
-				Attrs:     attrs,
+				Name:       name,
+				Constants:  constants,
+				Attrs:      attrs,
+				Doc:        doc,
+				Deprecated: p.deprecation(name, specifierAttrs(decln.DeclarationSpecifiers), pos.Filename, pos.Line, pos.Line, doc),
 			}, nil
 		}
 	}
@@ -319,6 +613,6 @@ func (p *Parser) parseEnum(decln *cc.Declaration) (EnumDecl, error) {
 }
 
 func (p *Parser) parseStruct(decln *cc.Declaration) (StructDecl, error) {
-	// TODO
+	// TODO parse members, so that their layouts can be checked
 	return StructDecl{}, nil
 }
@@ -4,33 +4,141 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
 )
 
 const (
-	attrsPrefix = "#attrs: "
-	maxAttrs    = 32
+	attrsPrefix   = "#attrs:"
+	includePrefix = "#include:"
+	presetPrefix  = "#preset:"
+	maxAttrs      = 32
 )
 
-var attrsPrefixBytes = []byte(attrsPrefix)
+var (
+	attrsPrefixBytes   = []byte(attrsPrefix)
+	includePrefixBytes = []byte(includePrefix)
+	presetPrefixBytes  = []byte(presetPrefix)
+	presetNameRegexp   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// PatternSyntax identifies how the text of a pattern is interpreted.
+type PatternSyntax string
+
+const (
+	// SyntaxRegexp patterns are regular expressions which must match the
+	// entire name; this is the default.
+	SyntaxRegexp PatternSyntax = "regexp"
+	// SyntaxExact patterns are written as =name and match only that name.
+	SyntaxExact PatternSyntax = "exact"
+	// SyntaxGlob patterns are written as glob:pattern and use shell glob
+	// syntax, where * matches any sequence of characters, ? matches any one
+	// character, and [...] matches a character class.
+	SyntaxGlob PatternSyntax = "glob"
+)
+
+const (
+	exactPrefix = "="
+	globPrefix  = "glob:"
+)
 
 type Pattern struct {
+	Syntax PatternSyntax
+	// Text is the pattern as written, without any negation.
+	Text string
+	// Regexp is the compiled form of regexp and glob patterns; it is nil for
+	// exact patterns.
 	Regexp *regexp.Regexp
 	Negate bool
 	Attrs  map[string]string
+	// File and Line locate the pattern in its source file.
+	File string
+	Line int
+	// AttrsLine is the line of the #attrs: directive which set Attrs, or 0
+	// if no attributes are in effect.
+	AttrsLine int
+}
+
+// Match reports whether the pattern matches the entire name.
+func (p *Pattern) Match(name string) bool {
+	if p.Syntax == SyntaxExact {
+		return strings.TrimPrefix(p.Text, exactPrefix) == name
+	}
+	return p.Regexp.FindString(name) == name
+}
+
+// Location returns the file name and line number of the pattern.
+func (p *Pattern) Location() string {
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// parsePatterns parses the patterns for declarations of the given kind from
+// the file and inline lines of src, validating attributes against the
+// registry. Presets defined in the file may be used by the inline lines.
+func parsePatterns(src PatternSource, kind DeclKind) ([]Pattern, error) {
+	p := &patternParser{
+		kind:    kind,
+		presets: make(map[string]map[string]string),
+	}
+	if src.File != "" {
+		if err := p.parseFile(src.File); err != nil {
+			return nil, err
+		}
+	}
+	if len(src.Patterns) != 0 {
+		reader := strings.NewReader(strings.Join(src.Patterns, "\n"))
+		if err := p.parse(src.inlineName, src.inlineDir, reader); err != nil {
+			return nil, err
+		}
+	}
+	return p.patterns, nil
+}
+
+// patternParser holds the state shared between a pattern file and the files
+// it includes.
+type patternParser struct {
+	kind     DeclKind
+	patterns []Pattern
+	// presets maps preset names to their attributes.
+	presets map[string]map[string]string
+	// including is the stack of absolute paths of the files being parsed,
+	// used to detect include cycles.
+	including []string
 }
 
-func parsePatterns(fileName string) ([]Pattern, error) {
+func (p *patternParser) parseFile(fileName string) error {
+	absName, err := filepath.Abs(fileName)
+	if err != nil {
+		return fmt.Errorf("resolving path of file '%s': %w", fileName, err)
+	}
+	for _, name := range p.including {
+		if name == absName {
+			return fmt.Errorf("include cycle: file '%s' is already being parsed", fileName)
+		}
+	}
+	p.including = append(p.including, absName)
+	defer func() {
+		p.including = p.including[:len(p.including)-1]
+	}()
 	file, err := os.Open(fileName)
 	if err != nil {
-		return nil, fmt.Errorf("opening file: %w", err)
+		return fmt.Errorf("opening file: %w", err)
 	}
 	defer file.Close()
-	scanner := bufio.NewScanner(file)
+	return p.parse(fileName, filepath.Dir(fileName), file)
+}
+
+// parse parses patterns from reader, using fileName in diagnostics and
+// resolving relative includes against dir.
+func (p *patternParser) parse(fileName, dir string, reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
 	lineNum := 0
-	var patterns []Pattern
 	var attrs map[string]string
+	attrsLine := 0
 	for scanner.Scan() {
 		lineNum++
 		line := scanner.Bytes()
@@ -38,6 +146,33 @@ func parsePatterns(fileName string) ([]Pattern, error) {
 		negate := false
 		if len(line) == 0 {
 			continue
+		} else if bytes.HasPrefix(line, includePrefixBytes) {
+			includeName := string(bytes.TrimSpace(bytes.TrimPrefix(line, includePrefixBytes)))
+			if includeName == "" {
+				return fmt.Errorf("%s:%d: missing file name to include", fileName, lineNum)
+			}
+			if !filepath.IsAbs(includeName) {
+				includeName = filepath.Join(dir, includeName)
+			}
+			if err := p.parseFile(includeName); err != nil {
+				return fmt.Errorf("%s:%d: including file '%s': %w", fileName, lineNum, includeName, err)
+			}
+			continue
+		} else if bytes.HasPrefix(line, presetPrefixBytes) {
+			line = bytes.TrimSpace(bytes.TrimPrefix(line, presetPrefixBytes))
+			parts := bytes.SplitN(line, []byte{'='}, 2)
+			name := string(bytes.TrimSpace(parts[0]))
+			if len(parts) != 2 || !presetNameRegexp.MatchString(name) {
+				return fmt.Errorf("%s:%d: preset must be given as name = key[=value][,...]", fileName, lineNum)
+			} else if _, ok := p.presets[name]; ok {
+				return fmt.Errorf("%s:%d: preset @%s is already defined", fileName, lineNum, name)
+			}
+			presetAttrs, err := p.parseAttrs(bytes.TrimSpace(parts[1]))
+			if err != nil {
+				return fmt.Errorf("%s:%d: %w", fileName, lineNum, err)
+			}
+			p.presets[name] = presetAttrs
+			continue
 		} else if line[0] == '#' {
 			if !bytes.HasPrefix(line, attrsPrefixBytes) {
 				continue
@@ -45,38 +180,182 @@ func parsePatterns(fileName string) ([]Pattern, error) {
 			line = bytes.TrimSpace(bytes.TrimPrefix(line, attrsPrefixBytes))
 			if len(line) == 0 {
 				attrs = nil
+				attrsLine = 0
 				continue
 			}
-			attrStrs := bytes.SplitN(line, []byte{','}, maxAttrs+1)
-			if len(attrStrs) > maxAttrs {
-				return nil, fmt.Errorf("too many attributes specified on line %d", lineNum)
+			newAttrs, err := p.parseAttrs(line)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %w", fileName, lineNum, err)
 			}
-			attrs = make(map[string]string, len(attrStrs))
-			for _, attrStr := range attrStrs {
-				parts := bytes.SplitN(attrStr, []byte{'='}, 2)
-				key := string(bytes.TrimSpace(parts[0]))
-				value := ""
-				if len(parts) > 1 {
-					value = string(bytes.TrimSpace(parts[1]))
+			attrs = newAttrs
+			for key, value := range attrs {
+				if err := validateAttr(p.kind, key, value); err != nil {
+					return fmt.Errorf("%s:%d: %w", fileName, lineNum, err)
 				}
-				attrs[key] = value
 			}
+			attrsLine = lineNum
+			continue
 		} else if line[0] == '!' {
 			negate = true
 			line = bytes.TrimSpace(line[1:])
 		}
-		re, err := regexp.Compile(string(line))
+		pattern, err := compilePattern(string(line))
 		if err != nil {
-			return nil, fmt.Errorf("compiling line %d: %w", lineNum, err)
+			return fmt.Errorf("%s:%d: compiling pattern: %w", fileName, lineNum, err)
 		}
-		patterns = append(patterns, Pattern{
-			Regexp: re,
-			Negate: negate,
-			Attrs:  attrs,
+		p.patterns = append(p.patterns, Pattern{
+			Syntax:    pattern.Syntax,
+			Text:      pattern.Text,
+			Regexp:    pattern.Regexp,
+			Negate:    negate,
+			Attrs:     attrs,
+			File:      fileName,
+			Line:      lineNum,
+			AttrsLine: attrsLine,
 		})
 	}
 	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("scanner error: %w", err)
+		return fmt.Errorf("scanner error: %w", err)
+	}
+	return nil
+}
+
+// parseAttrs parses a comma-separated list of attributes, each of which is
+// either key[=value] or @preset. A value may be written as a double-quoted Go
+// string literal to include commas.
+func (p *patternParser) parseAttrs(line []byte) (map[string]string, error) {
+	attrStrs, err := splitAttrs(line)
+	if err != nil {
+		return nil, err
+	} else if len(attrStrs) > maxAttrs {
+		return nil, fmt.Errorf("too many attributes specified")
+	}
+	attrs := make(map[string]string, len(attrStrs))
+	for _, attrStr := range attrStrs {
+		attrStr = bytes.TrimSpace(attrStr)
+		if len(attrStr) != 0 && attrStr[0] == '@' {
+			name := string(attrStr[1:])
+			presetAttrs, ok := p.presets[name]
+			if !ok {
+				return nil, fmt.Errorf("undefined preset @%s", name)
+			}
+			for key, value := range presetAttrs {
+				attrs[key] = value
+			}
+			continue
+		}
+		parts := bytes.SplitN(attrStr, []byte{'='}, 2)
+		key := string(bytes.TrimSpace(parts[0]))
+		value := ""
+		if len(parts) > 1 {
+			value = string(bytes.TrimSpace(parts[1]))
+		}
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted value of attribute %s: %w", key, err)
+			}
+			value = unquoted
+		}
+		attrs[key] = value
+	}
+	return attrs, nil
+}
+
+// splitAttrs splits a list of attributes at the commas which are not inside
+// double quotes.
+func splitAttrs(line []byte) ([][]byte, error) {
+	var attrStrs [][]byte
+	start := 0
+	inQuotes := false
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case inQuotes && c == '\\':
+			i++
+		case c == '"':
+			inQuotes = !inQuotes
+		case !inQuotes && c == ',':
+			attrStrs = append(attrStrs, line[start:i])
+			start = i + 1
+		}
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quoted attribute value")
+	}
+	return append(attrStrs, line[start:]), nil
+}
+
+// compilePattern compiles the text of a pattern according to its syntax.
+func compilePattern(text string) (Pattern, error) {
+	pattern := Pattern{
+		Syntax: SyntaxRegexp,
+		Text:   text,
+	}
+	var err error
+	if strings.HasPrefix(text, exactPrefix) {
+		pattern.Syntax = SyntaxExact
+		if name := strings.TrimPrefix(text, exactPrefix); name == "" {
+			return Pattern{}, fmt.Errorf("empty exact name")
+		}
+	} else if strings.HasPrefix(text, globPrefix) {
+		pattern.Syntax = SyntaxGlob
+		pattern.Regexp, err = compileGlob(strings.TrimPrefix(text, globPrefix))
+	} else {
+		pattern.Regexp, err = regexp.Compile(text)
+	}
+	if err != nil {
+		return Pattern{}, err
+	}
+	return pattern, nil
+}
+
+// compileGlob translates a shell glob into an anchored regexp in which every
+// wildcard is a capturing group.
+func compileGlob(glob string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			expr.WriteString("(.*)")
+		case '?':
+			expr.WriteString("(.)")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class in glob '%s'", glob)
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("([" + class + "])")
+			i += end + 1
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// checkExactPatterns returns an error if any exact pattern names a
+// declaration of the given kind which is not in decls.
+func checkExactPatterns(kind DeclKind, patterns []Pattern, decls []DeclRef) error {
+	found := make(map[string]bool)
+	for _, ref := range decls {
+		if ref.Kind == kind {
+			found[ref.Name] = true
+		}
+	}
+	for i := range patterns {
+		pattern := &patterns[i]
+		if pattern.Syntax != SyntaxExact {
+			continue
+		}
+		if name := strings.TrimPrefix(pattern.Text, exactPrefix); !found[name] {
+			return fmt.Errorf("%s: exact name %s does not match any %s in the header", pattern.Location(), name, kind)
+		}
 	}
-	return patterns, nil
+	return nil
 }
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDeadPatterns(t *testing.T) {
+	src := `enum nk_heading {NK_UP, NK_RIGHT, NK_DOWN, NK_LEFT};
+void nk_foo(struct nk_context *ctx);
+void nk_bar(struct nk_context *ctx);
+`
+	ext := filepath.Join(t.TempDir(), "ext.h")
+	if err := os.WriteFile(ext, []byte("void nk_ext(struct nk_context *ctx);\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{
+		Headers: []string{ext},
+		Files:   PatternSource{Patterns: []string{`nk\.h`, `unused\.h`}},
+		Enums:   PatternSource{Patterns: []string{"nk_heading", "nk_direction"}},
+		Funcs:   PatternSource{Patterns: []string{"nk_foo", "nk_bar", "!nk_bar", "nk_baz", "!nk_qux", "nk_ext"}},
+	}
+	gen, err := testGenerate(t, src, cfg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, pattern := range gen.matcher.DeadPatterns() {
+		text := pattern.Text
+		if pattern.Negate {
+			text = "!" + text
+		}
+		got = append(got, text)
+	}
+	// nk_ext is only declared in a header which the file patterns exclude
+	want := []string{`unused\.h`, "nk_direction", "nk_baz", "!nk_qux", "nk_ext"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got dead patterns %q, want %q", got, want)
+	}
+}
+
+func TestPatternIncludes(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		// patterns are the texts of the patterns parsed from main.txt, each
+		// followed by =value if it has a name attribute
+		patterns []string
+		err      string
+	}{
+		{
+			name: "nested",
+			files: map[string]string{
+				"main.txt":  "nk_a\n#include: sub/b.txt\nnk_c\n",
+				"sub/b.txt": "nk_b\n#include: c.txt\n",
+				"sub/c.txt": "nk_b2\n",
+			},
+			patterns: []string{"nk_a", "nk_b", "nk_b2", "nk_c"},
+		},
+		{
+			name: "diamond",
+			files: map[string]string{
+				"main.txt": "#include: b.txt\n#include: c.txt\n",
+				"b.txt":    "#include: d.txt\n",
+				"c.txt":    "#include: d.txt\n",
+				"d.txt":    "nk_d\n",
+			},
+			patterns: []string{"nk_d", "nk_d"},
+		},
+		{
+			name:  "self",
+			files: map[string]string{"main.txt": "nk_a\n#include: main.txt\n"},
+			err:   "include cycle: file '%dir%/main.txt' is already being parsed",
+		},
+		{
+			name: "cycle",
+			files: map[string]string{
+				"main.txt": "#include: b.txt\n",
+				"b.txt":    "#include: main.txt\n",
+			},
+			err: "%dir%/b.txt:1: including file '%dir%/main.txt': include cycle",
+		},
+		{
+			name: "preset from include",
+			files: map[string]string{
+				"main.txt":    "#include: presets.txt\n#attrs: @short\nnk_a\n",
+				"presets.txt": "#preset: short = name=A\n",
+			},
+			patterns: []string{"nk_a=A"},
+		},
+		{
+			name: "preset of presets",
+			files: map[string]string{
+				"main.txt": "#preset: a = name=A\n#preset: b = @a\n#attrs: @b\nnk_a\n",
+			},
+			patterns: []string{"nk_a=A"},
+		},
+		{
+			// presets must be defined before use, so they cannot form cycles
+			name: "preset cycle",
+			files: map[string]string{
+				"main.txt": "#preset: b = @a\n#preset: a = @b\n",
+			},
+			err: "main.txt:1: undefined preset @a",
+		},
+		{
+			name: "preset redefined by include",
+			files: map[string]string{
+				"main.txt":    "#preset: short = name=A\n#include: presets.txt\n",
+				"presets.txt": "#preset: short = name=B\n",
+			},
+			err: "presets.txt:1: preset @short is already defined",
+		},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		for name, src := range test.files {
+			fileName := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(fileName), 0o777); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(fileName, []byte(src), 0o666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		patterns, err := parsePatterns(PatternSource{File: filepath.Join(dir, "main.txt")}, DeclFunc)
+		if test.err != "" {
+			want := strings.ReplaceAll(test.err, "%dir%", dir)
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: got error %v, want one containing %q", test.name, err, want)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		var got []string
+		for _, pattern := range patterns {
+			text := pattern.Text
+			if name, ok := pattern.Attrs[AttrName]; ok {
+				text += "=" + name
+			}
+			got = append(got, text)
+		}
+		if !reflect.DeepEqual(got, test.patterns) {
+			t.Errorf("%s: got patterns %q, want %q", test.name, got, test.patterns)
+		}
+	}
+}
+
+func TestPatternSyntax(t *testing.T) {
+	tests := []struct {
+		text    string
+		syntax  PatternSyntax
+		match   []string
+		noMatch []string
+	}{
+		{"nk_button_.*", SyntaxRegexp, []string{"nk_button_text", "nk_button_"}, []string{"nk_button", "my_nk_button_x"}},
+		{"glob:nk_button_*", SyntaxGlob, []string{"nk_button_text", "nk_button_"}, []string{"nk_button", "xnk_button_a"}},
+		{"glob:nk_?_end", SyntaxGlob, []string{"nk_a_end"}, []string{"nk_ab_end", "nk__end2"}},
+		{"glob:nk_[rg]b", SyntaxGlob, []string{"nk_rb", "nk_gb"}, []string{"nk_bb", "nk_[rg]b"}},
+		{"glob:nk_[!r]b", SyntaxGlob, []string{"nk_gb"}, []string{"nk_rb"}},
+		{"glob:nk.h", SyntaxGlob, []string{"nk.h"}, []string{"nkxh"}},
+		{"=nk_begin", SyntaxExact, []string{"nk_begin"}, []string{"nk_begin_titled", "=nk_begin", "nk_beginx"}},
+		{"=nk_.*", SyntaxExact, []string{"nk_.*"}, []string{"nk_begin"}},
+	}
+	for _, test := range tests {
+		pattern, err := compilePattern(test.text)
+		if err != nil {
+			t.Errorf("%s: %v", test.text, err)
+			continue
+		}
+		if pattern.Syntax != test.syntax {
+			t.Errorf("%s: got syntax %s, want %s", test.text, pattern.Syntax, test.syntax)
+		}
+		for _, name := range test.match {
+			if !pattern.Match(name) {
+				t.Errorf("%s: does not match %s", test.text, name)
+			}
+		}
+		for _, name := range test.noMatch {
+			if pattern.Match(name) {
+				t.Errorf("%s: matches %s", test.text, name)
+			}
+		}
+	}
+	for _, text := range []string{"=", "glob:nk_[ab", "nk_("} {
+		if _, err := compilePattern(text); err == nil {
+			t.Errorf("%q: got no error", text)
+		}
+	}
+}
+
+func TestCheckExactPatterns(t *testing.T) {
+	patterns, err := parsePatterns(PatternSource{
+		Patterns:   []string{"=nk_begin", "!=nk_end", "nk_missing.*", "glob:nk_gone_*"},
+		inlineName: "inline",
+	}, DeclFunc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decls := []DeclRef{{Kind: DeclFunc, Name: "nk_begin"}, {Kind: DeclFunc, Name: "nk_end"}}
+	if err := checkExactPatterns(DeclFunc, patterns, decls); err != nil {
+		t.Errorf("declared names: %v", err)
+	}
+	// an enum of the same name does not count
+	decls[1].Kind = DeclEnum
+	err = checkExactPatterns(DeclFunc, patterns, decls)
+	if want := "inline:2: exact name nk_end does not match any function in the header"; err == nil ||
+		err.Error() != want {
+		t.Errorf("undeclared name: got error %v, want %q", err, want)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"modernc.org/cc/v3"
+)
+
+// profileFS holds the builtin target profiles: profiles/<goos>_<goarch>.h
+// defines the macros predefined by a C compiler for the target, and
+// profiles/include holds a minimal set of libc headers shared by all targets.
+//
+//go:embed profiles
+var profileFS embed.FS
+
+// builtinIncludeDir is the system include directory under which the bundled
+// libc headers are served to the parser; it does not exist on disk.
+const builtinIncludeDir = "/nkgen/include"
+
+// builtinProfiles returns the targets which have a builtin profile, sorted.
+func builtinProfiles() []string {
+	entries, err := profileFS.ReadDir("profiles")
+	if err != nil {
+		panic(err)
+	}
+	var targets []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || path.Ext(name) != ".h" {
+			continue
+		}
+		targets = append(targets, strings.Replace(strings.TrimSuffix(name, ".h"), "_", "/", 1))
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// builtinPredefined returns the predefined macros of the builtin profile for
+// target.
+func builtinPredefined(target Target) (string, error) {
+	data, err := profileFS.ReadFile("profiles/" + target.GOOS + "_" + target.GOARCH + ".h")
+	if err != nil {
+		return "", fmt.Errorf("no builtin profile for target '%s'; available profiles are %s", target,
+			strings.Join(builtinProfiles(), ", "))
+	}
+	return string(data), nil
+}
+
+// builtinFilesystem returns a filesystem serving the bundled libc headers
+// under builtinIncludeDir and everything else from the local filesystem.
+func builtinFilesystem() cc.Filesystem {
+	files := make(map[string]string)
+	err := fs.WalkDir(profileFS, "profiles/include", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, err := profileFS.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		files[path.Join(builtinIncludeDir, strings.TrimPrefix(name, "profiles/include/"))] = string(data)
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	return cc.Overlay(cc.StaticFS(files), cc.LocalFS())
+}
@@ -0,0 +1,7 @@
+/* Minimal assert.h for parsing headers without a C toolchain. */
+#ifndef _ASSERT_H
+#define _ASSERT_H
+
+#define assert(expr) ((void)0)
+
+#endif
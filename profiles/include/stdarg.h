@@ -0,0 +1,8 @@
+/* Minimal stdarg.h for parsing headers without a C toolchain. Only the name
+   of va_list matters to the generator, so its representation is opaque. */
+#ifndef _STDARG_H
+#define _STDARG_H
+
+typedef void *va_list;
+
+#endif
@@ -0,0 +1,10 @@
+/* Minimal stdbool.h for parsing headers without a C toolchain. */
+#ifndef _STDBOOL_H
+#define _STDBOOL_H
+
+#define bool _Bool
+#define true 1
+#define false 0
+#define __bool_true_false_are_defined 1
+
+#endif
@@ -0,0 +1,21 @@
+/* Minimal stdio.h for parsing headers without a C toolchain. */
+#ifndef _STDIO_H
+#define _STDIO_H
+
+#include <stdarg.h>
+#include <stddef.h>
+
+typedef struct _FILE FILE;
+
+FILE *fopen(const char *path, const char *mode);
+int fclose(FILE *file);
+size_t fread(void *ptr, size_t size, size_t count, FILE *file);
+int fseek(FILE *file, long offset, int whence);
+long ftell(FILE *file);
+int vsnprintf(char *s, size_t n, const char *format, va_list args);
+
+#define SEEK_SET 0
+#define SEEK_CUR 1
+#define SEEK_END 2
+
+#endif
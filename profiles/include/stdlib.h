@@ -0,0 +1,15 @@
+/* Minimal stdlib.h for parsing headers without a C toolchain. */
+#ifndef _STDLIB_H
+#define _STDLIB_H
+
+#include <stddef.h>
+
+void *malloc(size_t size);
+void *calloc(size_t count, size_t size);
+void *realloc(void *ptr, size_t size);
+void free(void *ptr);
+void abort(void);
+double strtod(const char *s, char **end);
+long strtol(const char *s, char **end, int base);
+
+#endif
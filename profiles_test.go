@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestBuiltinProfiles parses a header using every bundled libc header with
+// each builtin profile and checks the sizes of target-dependent types.
+func TestBuiltinProfiles(t *testing.T) {
+	src := `#include <assert.h>
+#include <stdarg.h>
+#include <stdbool.h>
+#include <stddef.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+long nk_long(void);
+size_t nk_size(void);
+void *nk_ptr(void);
+int64_t nk_int64(void);
+`
+	fileName := filepath.Join(t.TempDir(), "nk.h")
+	if err := os.WriteFile(fileName, []byte(src), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	funcPatterns, err := parsePatterns(PatternSource{Patterns: []string{"nk_.*"}}, DeclFunc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profiles := builtinProfiles()
+	if len(profiles) == 0 {
+		t.Fatal("no builtin profiles")
+	}
+	for _, profile := range profiles {
+		targets, err := parseBuiltinTargets(profile)
+		if err != nil {
+			t.Errorf("%s: %v", profile, err)
+			continue
+		}
+		opts, err := parseOptions(&Config{}, targets[0])
+		if err != nil {
+			t.Errorf("%s: %v", profile, err)
+			continue
+		}
+		result, err := NewParser(NewPatternMatcher(nil, nil, funcPatterns, nil), opts).Parse([]string{fileName})
+		if err != nil {
+			t.Errorf("%s: %v", profile, err)
+			continue
+		}
+		wordSize := int64(8)
+		if targets[0].GOARCH == "386" || targets[0].GOARCH == "arm" {
+			wordSize = 4
+		}
+		want := map[string]int64{"nk_long": wordSize, "nk_size": wordSize, "nk_ptr": wordSize, "nk_int64": 8}
+		for _, f := range result.Funcs {
+			if got := f.Return.Layout.Size; got != want[f.Name] {
+				t.Errorf("%s: %s returns size %d, want %d", profile, f.Name, got, want[f.Name])
+			}
+			delete(want, f.Name)
+		}
+		for name := range want {
+			t.Errorf("%s: function %s not found", profile, name)
+		}
+	}
+}
+
+func TestParseBuiltinTargets(t *testing.T) {
+	tests := []struct {
+		s       string
+		targets []Target
+		err     string
+	}{
+		{"linux/amd64, darwin/arm64", []Target{
+			{GOOS: "linux", GOARCH: "amd64", Builtin: true},
+			{GOOS: "darwin", GOARCH: "arm64", Builtin: true},
+		}, ""},
+		{"plan9/amd64", nil, "no builtin profile for target 'plan9/amd64'"},
+		{"linux/amd64=linux.h", nil, "cannot be given predefined macros"},
+		{"linux", nil, "must be given as goos/goarch"},
+	}
+	for _, test := range tests {
+		targets, err := parseBuiltinTargets(test.s)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%q: got error %v, want one containing %q", test.s, err, test.err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%q: %v", test.s, err)
+			continue
+		}
+		if len(targets) != len(test.targets) {
+			t.Errorf("%q: got targets %v, want %v", test.s, targets, test.targets)
+			continue
+		}
+		for i := range targets {
+			if targets[i] != test.targets[i] {
+				t.Errorf("%q: got targets %v, want %v", test.s, targets, test.targets)
+				break
+			}
+		}
+	}
+}
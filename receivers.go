@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ReceiverRule describes how a function whose first parameter has a
+// particular C type is turned into a method on a Go type.
+type ReceiverRule struct {
+	// CType is the C type of the first parameter; qualifiers are ignored.
+	CType string `json:"ctype"`
+	// Name is the name of the receiver in the generated method.
+	Name string `json:"name"`
+	// GoType is the type of the receiver, e.g. "Color" or "*Context".
+	GoType string `json:"gotype"`
+	// Expr is an optional format string with a single %s verb which is
+	// replaced by the receiver name to produce the cgo argument. If it is
+	// empty, the receiver is converted the same way as any other parameter.
+	Expr string `json:"expr,omitempty"`
+}
+
+// validate checks the rule and normalizes its C type.
+func (rule *ReceiverRule) validate() error {
+	t, err := parseCType(rule.CType)
+	if err != nil {
+		return err
+	}
+	rule.CType = t.Key()
+	if rule.Name == "" || rule.GoType == "" {
+		return fmt.Errorf("receiver name and Go type must not be empty")
+	} else if rule.Expr != "" && strings.Count(rule.Expr, "%s") != 1 {
+		return fmt.Errorf("cgo expression '%s' must contain exactly one %%s", rule.Expr)
+	}
+	return nil
+}
+
+// loadReceiverRules returns the rules from the file of src, if any, followed
+// by its inline rules.
+func loadReceiverRules(src ReceiverSource) ([]ReceiverRule, error) {
+	var rules []ReceiverRule
+	if src.File != "" {
+		fileRules, err := parseReceiverRules(src.File)
+		if err != nil {
+			return nil, fmt.Errorf("parsing file '%s': %w", src.File, err)
+		}
+		rules = fileRules
+	}
+	for i, rule := range src.Rules {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("inline rule %d: %w", i, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func findReceiverRule(rules []ReceiverRule, t CType) (ReceiverRule, bool) {
+	for _, rule := range rules {
+		if rule.CType == t.Key() {
+			return rule, true
+		}
+	}
+	return ReceiverRule{}, false
+}
+
+func parseReceiverRules(fileName string) ([]ReceiverRule, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %w", err)
+	}
+	defer file.Close()
+	var rules []ReceiverRule
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	for {
+		record, err := reader.Read()
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("CSV read error: %w", err)
+		} else if len(record) == 0 {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) < 3 || len(record) > 4 {
+			return nil, fmt.Errorf("line %d: expected 3 or 4 fields, got %d", line, len(record))
+		}
+		rule := ReceiverRule{
+			CType:  record[0],
+			Name:   record[1],
+			GoType: record[2],
+		}
+		if len(record) == 4 {
+			rule.Expr = record[3]
+		}
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
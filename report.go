@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// ReportStatus describes what became of a declaration found in the header.
+type ReportStatus string
+
+const (
+	// StatusGenerated means a binding was generated.
+	StatusGenerated ReportStatus = "generated"
+	// StatusFailed means the declaration was matched but generation failed.
+	StatusFailed ReportStatus = "failed"
+	// StatusUnsupported means the declaration was matched but the generator
+	// does not support declarations of its kind.
+	StatusUnsupported ReportStatus = "unsupported"
+	// StatusExisting means the target package already binds the declaration.
+	StatusExisting ReportStatus = "existing"
+	// StatusExcluded means a negated pattern excluded the declaration or the
+	// header declaring it.
+	StatusExcluded ReportStatus = "excluded"
+	// StatusUnmatched means no pattern matched the declaration, or no file
+	// pattern matched the header declaring it.
+	StatusUnmatched ReportStatus = "unmatched"
+)
+
+var reportStatuses = []ReportStatus{
+	StatusGenerated,
+	StatusFailed,
+	StatusUnsupported,
+	StatusExisting,
+	StatusExcluded,
+	StatusUnmatched,
+}
+
+type ReportEntry struct {
+	Kind   DeclKind     `json:"kind"`
+	Name   string       `json:"name"`
+	Status ReportStatus `json:"status"`
+	Detail string       `json:"detail,omitempty"`
+}
+
+type Report struct {
+	Entries []ReportEntry `json:"entries"`
+	// Summary counts entries by kind, then by status.
+	Summary map[DeclKind]map[ReportStatus]int `json:"summary"`
+}
+
+// buildReport determines the status of every nk_* declaration in result.
+// The failures map holds the errors for declarations which could not be
+// generated.
+func buildReport(result ParseResult, matcher Matcher, failures map[DeclRef]error) Report {
+	report := Report{
+		Summary: make(map[DeclKind]map[ReportStatus]int),
+	}
+	for _, ref := range result.Decls {
+		if !strings.HasPrefix(ref.Name, "nk_") {
+			continue
+		}
+		entry := ReportEntry{
+			Kind: ref.Kind,
+			Name: ref.Name,
+		}
+		fileName := result.Files[ref]
+		fileDecision := matcher.Decide(DeclFile, fileName)
+		decision := matcher.Decide(ref.Kind, ref.Name)
+		if !fileDecision.Include && fileDecision.Pattern != nil {
+			entry.Status = StatusExcluded
+			entry.Detail = fmt.Sprintf("header %s excluded by %s: !%s", fileName, fileDecision.Pattern.Location(),
+				fileDecision.Pattern.Text)
+		} else if !fileDecision.Include {
+			entry.Status = StatusUnmatched
+			entry.Detail = fmt.Sprintf("no file pattern matched header %s", fileName)
+		} else if err, ok := failures[ref]; ok {
+			entry.Status = StatusFailed
+			entry.Detail = err.Error()
+		} else if decision.Include && ref.Kind == DeclStruct {
+			entry.Status = StatusUnsupported
+			entry.Detail = "structs are not generated yet"
+		} else if decision.Include {
+			entry.Status = StatusGenerated
+		} else if decision.Existing != "" {
+			entry.Status = StatusExisting
+			entry.Detail = decision.Existing
+		} else if decision.Pattern != nil {
+			entry.Status = StatusExcluded
+			entry.Detail = fmt.Sprintf("%s: !%s", decision.Pattern.Location(), decision.Pattern.Text)
+		} else {
+			entry.Status = StatusUnmatched
+		}
+		report.Entries = append(report.Entries, entry)
+		if report.Summary[ref.Kind] == nil {
+			report.Summary[ref.Kind] = make(map[ReportStatus]int)
+		}
+		report.Summary[ref.Kind][entry.Status]++
+	}
+	sort.SliceStable(report.Entries, func(i, j int) bool {
+		if report.Entries[i].Kind != report.Entries[j].Kind {
+			return report.Entries[i].Kind < report.Entries[j].Kind
+		}
+		return report.Entries[i].Name < report.Entries[j].Name
+	})
+	return report
+}
+
+func printReport(w io.Writer, report Report, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case "text":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		for _, entry := range report.Entries {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", entry.Kind, entry.Name, entry.Status, entry.Detail)
+		}
+		fmt.Fprintln(tw)
+		for _, kind := range []DeclKind{DeclEnum, DeclFunc, DeclStruct} {
+			counts := report.Summary[kind]
+			total := 0
+			for _, count := range counts {
+				total += count
+			}
+			if total == 0 {
+				continue
+			}
+			fmt.Fprintf(tw, "%s: %d total", kind, total)
+			for _, status := range reportStatuses {
+				if count := counts[status]; count != 0 {
+					fmt.Fprintf(tw, ", %d %s", count, status)
+				}
+			}
+			fmt.Fprintln(tw)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown report format '%s'", format)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	src := `void nk_ok(struct nk_context *ctx);
+void nk_tooltipf(struct nk_context *ctx, const char *fmt, ...);
+struct nk_point {int x, y;} nk_point_of(struct nk_context *ctx);
+void nk_skipped(struct nk_context *ctx);
+void nk_unpaired_begin(struct nk_context *ctx);
+`
+	dir := t.TempDir()
+	headers := map[string]string{
+		"ext.h":   "void nk_ext(struct nk_context *ctx);\n",
+		"other.h": "void nk_other(struct nk_context *ctx);\n",
+	}
+	cfg := Config{
+		Files: PatternSource{Patterns: []string{`nk\.h`, `ext\.h`, `!ext\.h`}},
+		Funcs: PatternSource{Patterns: []string{
+			"nk_.*",
+			"!nk_skipped",
+			"#attrs: pair=nk_unpaired_end",
+			"nk_unpaired_begin",
+		}},
+	}
+	for _, name := range []string{"ext.h", "other.h"} {
+		fileName := filepath.Join(dir, name)
+		if err := os.WriteFile(fileName, []byte(headers[name]), 0o666); err != nil {
+			t.Fatal(err)
+		}
+		cfg.Headers = append(cfg.Headers, fileName)
+	}
+	if _, err := testGenerate(t, src, cfg, false); err == nil {
+		t.Error("generating without reporting: got no error")
+	}
+	gen, err := testGenerate(t, src, cfg, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := buildReport(gen.result, gen.matcher, gen.failures)
+	entries := make(map[string]ReportEntry)
+	for _, entry := range report.Entries {
+		if entry.Kind == DeclFunc {
+			entries[entry.Name] = entry
+		}
+	}
+	tests := []struct {
+		name   string
+		status ReportStatus
+		detail string
+	}{
+		{"nk_ok", StatusGenerated, ""},
+		{"nk_tooltipf", StatusFailed, "function nk_tooltipf requires varargs support"},
+		{"nk_point_of", StatusFailed, "cannot resolve type of function nk_point_of"},
+		{"nk_skipped", StatusExcluded, "!nk_skipped"},
+		{"nk_unpaired_begin", StatusFailed, "end function nk_unpaired_end paired with function nk_unpaired_begin " +
+			"is not declared"},
+		{"nk_ext", StatusExcluded, "ext.h excluded by"},
+		{"nk_other", StatusUnmatched, "no file pattern matched header " + filepath.Join(dir, "other.h")},
+	}
+	for _, test := range tests {
+		entry, ok := entries[test.name]
+		if !ok {
+			t.Errorf("%s: not reported", test.name)
+			continue
+		}
+		if entry.Status != test.status || !strings.Contains(entry.Detail, test.detail) {
+			t.Errorf("%s: got %s (%s), want %s (%s)", test.name, entry.Status, entry.Detail, test.status, test.detail)
+		}
+	}
+	if got, want := len(entries), len(tests); got != want {
+		t.Errorf("got %d function entries, want %d", got, want)
+	}
+	if got := report.Summary[DeclFunc][StatusFailed]; got != 3 {
+		t.Errorf("got %d failed functions in summary, want 3", got)
+	}
+}
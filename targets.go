@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// Target is a GOOS/GOARCH pair to generate bindings for.
+type Target struct {
+	GOOS   string `json:"goos"`
+	GOARCH string `json:"goarch"`
+	// Predefined is the path to a file of C source, usually the output of
+	// running the target's C preprocessor with -dM, which replaces the
+	// macros predefined by the host C preprocessor.
+	Predefined string `json:"predefined,omitempty"`
+	// Builtin selects the builtin profile of the target, which supplies its
+	// predefined macros and a minimal set of libc headers, so that the host
+	// C preprocessor is not needed.
+	Builtin bool `json:"builtin,omitempty"`
+}
+
+func (target Target) String() string {
+	return target.GOOS + "/" + target.GOARCH
+}
+
+var targetPartRegexp = regexp.MustCompile(`^[a-z0-9]+$`)
+
+func (target Target) validate() error {
+	if !targetPartRegexp.MatchString(target.GOOS) || !targetPartRegexp.MatchString(target.GOARCH) {
+		return fmt.Errorf("invalid target '%s'", target)
+	}
+	if !target.Builtin && target.Predefined == "" && (target.GOOS != runtime.GOOS || target.GOARCH != runtime.GOARCH) {
+		// the macros predefined by the host C preprocessor do not match the
+		// ABI of another target
+		return fmt.Errorf("target '%s' is not the host, so it needs a builtin profile or predefined macros", target)
+	}
+	if target.Builtin {
+		if target.Predefined != "" {
+			return fmt.Errorf("target '%s' cannot have both a builtin profile and predefined macros", target)
+		}
+		if _, err := builtinPredefined(target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseTargets parses a comma-separated list of targets written as
+// goos/goarch[=predefined].
+func parseTargets(s string) ([]Target, error) {
+	targets, err := splitTargets(s)
+	if err != nil {
+		return nil, err
+	}
+	for _, target := range targets {
+		if err := target.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return targets, nil
+}
+
+// splitTargets parses a comma-separated list of targets without validating
+// them.
+func splitTargets(s string) ([]Target, error) {
+	var targets []Target
+	for _, targetStr := range strings.Split(s, ",") {
+		targetStr = strings.TrimSpace(targetStr)
+		if targetStr == "" {
+			continue
+		}
+		var target Target
+		if i := strings.IndexByte(targetStr, '='); i >= 0 {
+			target.Predefined = targetStr[i+1:]
+			targetStr = targetStr[:i]
+		}
+		parts := strings.Split(targetStr, "/")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("target '%s' must be given as goos/goarch[=predefined]", targetStr)
+		}
+		target.GOOS, target.GOARCH = parts[0], parts[1]
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// parseBuiltinTargets parses a comma-separated list of targets written as
+// goos/goarch, each of which uses its builtin profile.
+func parseBuiltinTargets(s string) ([]Target, error) {
+	targets, err := splitTargets(s)
+	if err != nil {
+		return nil, err
+	}
+	for i := range targets {
+		if targets[i].Predefined != "" {
+			return nil, fmt.Errorf("target '%s' uses a builtin profile and cannot be given predefined macros", targets[i])
+		}
+		targets[i].Builtin = true
+		if err := targets[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+	return targets, nil
+}
+
+// targetExpr returns the build constraint satisfied by the given targets.
+func targetExpr(targets []Target) constraint.Expr {
+	var expr constraint.Expr
+	for _, target := range targets {
+		var targetExpr constraint.Expr = &constraint.AndExpr{
+			X: &constraint.TagExpr{Tag: target.GOOS},
+			Y: &constraint.TagExpr{Tag: target.GOARCH},
+		}
+		if expr == nil {
+			expr = targetExpr
+		} else {
+			expr = &constraint.OrExpr{X: expr, Y: targetExpr}
+		}
+	}
+	return expr
+}
+
+// buildConstraintLines returns the //go:build and // +build lines for expr,
+// followed by a blank line.
+func buildConstraintLines(expr constraint.Expr) ([]byte, error) {
+	var lines bytes.Buffer
+	fmt.Fprintf(&lines, "//go:build %s\n", expr)
+	plusLines, err := constraint.PlusBuildLines(expr)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range plusLines {
+		fmt.Fprintln(&lines, line)
+	}
+	fmt.Fprintln(&lines)
+	return lines.Bytes(), nil
+}
+
+// writeTargetOutputs writes the outputs generated for several targets, each
+// with a build constraint selecting exactly the targets it was generated for,
+// so that the package does not build for platforms which are not targets. The
+// output of the first target is written to fileName, and each other distinct
+// output is written next to it.
+func writeTargetOutputs(fileName string, targets []Target, outputs [][]byte) error {
+	type group struct {
+		targets []Target
+		output  []byte
+	}
+	var groups []*group
+	for i, output := range outputs {
+		found := false
+		for _, g := range groups {
+			if bytes.Equal(g.output, output) {
+				g.targets = append(g.targets, targets[i])
+				found = true
+				break
+			}
+		}
+		if !found {
+			groups = append(groups, &group{targets: []Target{targets[i]}, output: output})
+		}
+	}
+	ext := filepath.Ext(fileName)
+	stem := strings.TrimSuffix(fileName, ext)
+	written := make(map[string]bool)
+	defer func() {
+		removeStaleTargetOutputs(stem, ext, written)
+	}()
+	for i, g := range groups {
+		targetFileName := fileName
+		if i > 0 {
+			// the suffix must not look like _GOOS_GOARCH, which would add an
+			// implicit constraint
+			targetFileName = fmt.Sprintf("%s_%s-%s%s", stem, g.targets[0].GOOS, g.targets[0].GOARCH, ext)
+			written[targetFileName] = true
+		}
+		if err := writeConstrained(targetFileName, targetExpr(g.targets), g.output); err != nil {
+			return err
+		}
+		debugf("wrote output for targets %v to file %s", g.targets, targetFileName)
+	}
+	return nil
+}
+
+// removeStaleTargetOutputs removes files written for targets by an earlier
+// run of this generator which were not written by this one, since their
+// declarations would collide with those in the files which were.
+func removeStaleTargetOutputs(stem, ext string, written map[string]bool) {
+	fileNames, err := filepath.Glob(stem + "_*-*" + ext)
+	if err != nil {
+		return
+	}
+	for _, fileName := range fileNames {
+		if written[fileName] {
+			continue
+		}
+		data, err := os.ReadFile(fileName)
+		if err != nil || !isOwnOutput(fileName, data) {
+			continue
+		}
+		if err := os.Remove(fileName); err != nil {
+			warnf("removing stale output file '%s': %v", fileName, err)
+		} else {
+			debugf("removed stale output file %s", fileName)
+		}
+	}
+}
+
+// isOwnOutput reports whether the Go source of the named file was written by
+// this generator, as opposed to other generators or by hand.
+func isOwnOutput(fileName string, src []byte) bool {
+	file, err := parser.ParseFile(token.NewFileSet(), fileName, src, parser.ParseComments|parser.PackageClauseOnly)
+	if err != nil {
+		return false
+	}
+	for _, group := range file.Comments {
+		for _, comment := range group.List {
+			if comment.Pos() < file.Package && comment.Text == generatedComment ||
+				comment.Text == legacyGeneratedComment {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func writeConstrained(fileName string, expr constraint.Expr, output []byte) error {
+	lines, err := buildConstraintLines(expr)
+	if err != nil {
+		return fmt.Errorf("formatting build constraint for file '%s': %w", fileName, err)
+	}
+	if err := os.WriteFile(fileName, append(lines, output...), 0o666); err != nil {
+		return fmt.Errorf("writing file '%s': %w", fileName, err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRemoveStaleTargetOutputs(t *testing.T) {
+	dir := t.TempDir()
+	files := []struct {
+		name    string
+		src     string
+		written bool
+		removed bool
+	}{
+		{"nk_linux-amd64.go", "//go:build linux && amd64\n// +build linux,amd64\n\n" + generatedComment +
+			"\n\npackage nk\n", false, true},
+		{"nk_linux-arm64.go", "//go:build linux && arm64\n// +build linux,arm64\n\n" + generatedComment +
+			"\n\npackage nk\n", true, false},
+		{"nk_freebsd-amd64.go", "package nk\n\n" + legacyGeneratedComment + "\n", false, true},
+		{"nk_darwin-amd64.go", "// Code generated by stringer; DO NOT EDIT.\n\npackage nk\n", false, false},
+		{"nk_windows-amd64.go", "package nk\n\nfunc Begin() {}\n", false, false},
+		{"nk_openbsd-amd64.go", "package nk\n\n" + generatedComment + "\n", false, false},
+	}
+	written := make(map[string]bool)
+	for _, file := range files {
+		fileName := filepath.Join(dir, file.name)
+		if err := os.WriteFile(fileName, []byte(file.src), 0o666); err != nil {
+			t.Fatal(err)
+		}
+		if file.written {
+			written[fileName] = true
+		}
+	}
+	removeStaleTargetOutputs(filepath.Join(dir, "nk"), ".go", written)
+	for _, file := range files {
+		_, err := os.Stat(filepath.Join(dir, file.name))
+		if removed := os.IsNotExist(err); removed != file.removed {
+			t.Errorf("%s: got removed %v, want %v", file.name, removed, file.removed)
+		}
+	}
+}
+
+func TestWriteTargetOutputs(t *testing.T) {
+	linuxAMD64 := Target{GOOS: "linux", GOARCH: "amd64"}
+	linuxARM64 := Target{GOOS: "linux", GOARCH: "arm64"}
+	windowsAMD64 := Target{GOOS: "windows", GOARCH: "amd64"}
+	tests := []struct {
+		name    string
+		targets []Target
+		outputs []string
+		// existing maps the names of files written earlier to their contents
+		existing map[string]string
+		// files maps the names of the files in the directory afterwards to
+		// their contents
+		files map[string]string
+	}{
+		{
+			name:    "single",
+			targets: []Target{linuxAMD64},
+			outputs: []string{"package nk\n"},
+			files: map[string]string{
+				"nk.go": "//go:build linux && amd64\n// +build linux,amd64\n\npackage nk\n",
+			},
+		},
+		{
+			name:    "same",
+			targets: []Target{linuxAMD64, linuxARM64, windowsAMD64},
+			outputs: []string{"package nk\n", "package nk\n", "package nk\n"},
+			files: map[string]string{
+				"nk.go": "//go:build (linux && amd64) || (linux && arm64) || (windows && amd64)\n" +
+					"// +build linux,amd64 linux,arm64 windows,amd64\n\npackage nk\n",
+			},
+		},
+		{
+			name:    "grouped",
+			targets: []Target{linuxAMD64, windowsAMD64, linuxARM64},
+			outputs: []string{"package nk\n", "package nk\n\n// windows\n", "package nk\n"},
+			existing: map[string]string{
+				"nk_linux-arm64.go": generatedComment + "\n\npackage nk\n\n// stale\n",
+			},
+			files: map[string]string{
+				"nk.go": "//go:build (linux && amd64) || (linux && arm64)\n// +build linux,amd64 linux,arm64\n\n" +
+					"package nk\n",
+				"nk_windows-amd64.go": "//go:build windows && amd64\n// +build windows,amd64\n\n" +
+					"package nk\n\n// windows\n",
+			},
+		},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		for name, src := range test.existing {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		outputs := make([][]byte, len(test.outputs))
+		for i, output := range test.outputs {
+			outputs[i] = []byte(output)
+		}
+		if err := writeTargetOutputs(filepath.Join(dir, "nk.go"), test.targets, outputs); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files := make(map[string]string)
+		for _, entry := range entries {
+			data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[entry.Name()] = string(data)
+		}
+		if !reflect.DeepEqual(files, test.files) {
+			t.Errorf("%s: got files %q, want %q", test.name, files, test.files)
+		}
+	}
+}
@@ -5,14 +5,84 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
-
-	"github.com/iancoleman/strcase"
 )
 
 type TypeConv struct {
 	GoType  string
 	CgoType string
+	Options TypeOptions
+}
+
+// byValue reports whether the conversion takes a Go value for a C pointer,
+// because of TypeByValue.
+func (conv TypeConv) byValue() bool {
+	return conv.Options&TypeByValue != 0 && strings.HasPrefix(conv.CgoType, "*") &&
+		!strings.HasPrefix(conv.GoType, "*")
+}
+
+// TypeOptions change how values of a mapped type are passed to C. They are
+// given in the last field of a typemap line, separated by spaces, and are
+// inherited by pointers derived from the type.
+type TypeOptions int32
+
+const (
+	// TypeUnsafePtr casts pointers through unsafe.Pointer, like the unsafeptr
+	// attribute.
+	TypeUnsafePtr TypeOptions = 1 << iota
+	// TypeByValue makes parameters which are pointers to the type take a Go
+	// value, whose address is passed to C.
+	TypeByValue
+	// TypeNilable marks pointers to the type as possibly nil; for strings,
+	// the empty string is passed as NULL.
+	TypeNilable
+	// TypeNoAutoPtr requires pointers to the type to be mapped explicitly.
+	TypeNoAutoPtr
+	// TypeCStringNoLen means strings are not followed by a length parameter,
+	// like the nostrlen attribute.
+	TypeCStringNoLen
+)
+
+var typeOptionNames = []struct {
+	name   string
+	option TypeOptions
+}{
+	{"unsafeptr", TypeUnsafePtr},
+	{"byvalue", TypeByValue},
+	{"nilable", TypeNilable},
+	{"noautoptr", TypeNoAutoPtr},
+	{"cstring-nolen", TypeCStringNoLen},
+}
+
+// parseTypeOptions parses a space-separated list of type options.
+func parseTypeOptions(s string) (TypeOptions, error) {
+	var options TypeOptions
+	for _, name := range strings.Fields(s) {
+		found := false
+		for _, opt := range typeOptionNames {
+			if opt.name == name {
+				options |= opt.option
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown type option '%s'", name)
+		}
+	}
+	return options, nil
+}
+
+func (options TypeOptions) String() string {
+	var names []string
+	for _, opt := range typeOptionNames {
+		if options&opt.option != 0 {
+			names = append(names, opt.name)
+		}
+	}
+	return strings.Join(names, " ")
 }
 
 type ConvertTypeOpts int32
@@ -24,65 +94,265 @@ const (
 	ConvertTypeDefault = ConvertTypeAutoPtr | ConvertTypeAutoStructEnum
 )
 
-func convertType(typeMap map[string]TypeConv, cType string, options ConvertTypeOpts) (goType string, cgoType string, err error) {
+func convertType(typeMap *TypeMap, t CType, options ConvertTypeOpts) (conv TypeConv, err error) {
 	defer func() {
 		if err == nil {
-			debugf("converted C type '%s' to Go type '%s' and cgo type '%s'", cType, goType, cgoType)
+			debugf("converted C type '%s' to Go type '%s' and cgo type '%s' with options '%s'", t, conv.GoType,
+				conv.CgoType, conv.Options)
 		}
 	}()
-	return _convertType(typeMap, cType, options)
+	return convertCType(typeMap, t, options)
 }
 
-func _convertType(typeMap map[string]TypeConv, cType string, options ConvertTypeOpts) (goType string, cgoType string, err error) {
-	cType = strings.TrimPrefix(cType, "const ")
-	if mapping, ok := typeMap[cType]; ok {
-		return mapping.GoType, mapping.CgoType, nil
+// convertCType converts a C type, ignoring its qualifiers. The size of the C
+// type is checked against the Go type if it is predeclared; the layouts of
+// structs are not checked.
+func convertCType(typeMap *TypeMap, t CType, options ConvertTypeOpts) (TypeConv, error) {
+	if mapping, ok := typeMap.lookup(t); ok {
+		size := t.Layout.Size
+		if mapping.GoType == sizedIntType || mapping.GoType == sizedUintType {
+			if size == 0 {
+				return TypeConv{}, fmt.Errorf("size of C type '%s' is unknown, so Go type %s cannot be resolved", t,
+					mapping.GoType)
+			}
+			mapping.GoType = fmt.Sprintf("%s%d", strings.TrimPrefix(mapping.GoType, "$"), 8*size)
+		}
+		if goSize, ok := goTypeSizes[mapping.GoType]; ok && size != 0 && size != goSize {
+			return TypeConv{}, fmt.Errorf("C type '%s' has size %d on the target, but Go type '%s' mapped to it has "+
+				"size %d", t, size, mapping.GoType, goSize)
+		}
+		return mapping, nil
 	}
-	if options&ConvertTypeAutoPtr != 0 && strings.HasSuffix(cType, "*") {
-		cType = strings.TrimSpace(strings.TrimSuffix(cType, "*"))
-		rawGoType, rawCgoType, err := _convertType(typeMap, cType, options)
+	if options&ConvertTypeAutoPtr != 0 && t.IsPointer() {
+		elemType := t.Elem()
+		elem, err := convertCType(typeMap, elemType, options)
 		if err != nil {
-			return "", "", fmt.Errorf("resolving type '%s': %w", cType, err)
+			return TypeConv{}, fmt.Errorf("resolving type '%s': %w", elemType, err)
+		} else if elem.Options&TypeNoAutoPtr != 0 {
+			return TypeConv{}, fmt.Errorf("type '%s' has option noautoptr, so pointers to it must be mapped explicitly",
+				elemType)
+		} else if elem.byValue() {
+			return TypeConv{}, fmt.Errorf("pointer to '%s' which is passed by value", elemType)
+		}
+		conv := TypeConv{
+			GoType:  "*" + elem.GoType,
+			CgoType: "*" + elem.CgoType,
+			Options: elem.Options,
 		}
-		return "*" + rawGoType, "*" + rawCgoType, nil
+		if conv.Options&TypeByValue != 0 {
+			conv.GoType = elem.GoType
+		}
+		return conv, nil
 	}
-	if options&ConvertTypeAutoStructEnum != 0 && strings.HasPrefix(cType, "struct ") {
-		cType = strings.TrimPrefix(cType, "struct ")
-		goType = strcase.ToCamel(strings.TrimPrefix(cType, "nk_"))
-		cgoType = "C.struct_" + cType
-		return goType, cgoType, nil
-	} else if options&ConvertTypeAutoStructEnum != 0 && strings.HasPrefix(cType, "enum ") {
-		cType = strings.TrimPrefix(cType, "enum ")
-		goType = strcase.ToCamel(strings.TrimPrefix(cType, "nk_"))
-		cgoType = "C.enum_" + cType
-		return goType, cgoType, nil
+	plain := len(t.Pointers) == 0 && len(t.Dims) == 0
+	if options&ConvertTypeAutoStructEnum != 0 && plain && strings.HasPrefix(t.Base, "struct ") {
+		tag := t.Name()
+		return TypeConv{
+			GoType:  exportedName(strings.TrimPrefix(tag, "nk_")),
+			CgoType: "C.struct_" + tag,
+		}, nil
+	} else if options&ConvertTypeAutoStructEnum != 0 && plain && strings.HasPrefix(t.Base, "enum ") {
+		tag := t.Name()
+		goType, ok := typeMap.enumNames[t.Base]
+		if !ok {
+			goType = exportedName(strings.TrimPrefix(tag, "nk_"))
+		}
+		return TypeConv{
+			GoType:  goType,
+			CgoType: "C.enum_" + tag,
+		}, nil
 	}
-	return "", "", fmt.Errorf("unhandled C type '%s'", cType)
+	return TypeConv{}, fmt.Errorf("unhandled C type '%s'", t)
+}
+
+// sizedIntType and sizedUintType may be given as Go types in the typemap to
+// use the signed or unsigned integer type of the same size as the C type on
+// the target, e.g. int32 or int64 for long.
+const (
+	sizedIntType  = "$int"
+	sizedUintType = "$uint"
+)
+
+// goTypeSizes holds the sizes of the predeclared Go types whose size does not
+// depend on the target.
+var goTypeSizes = map[string]int64{
+	"bool":       1,
+	"byte":       1,
+	"int8":       1,
+	"uint8":      1,
+	"int16":      2,
+	"uint16":     2,
+	"int32":      4,
+	"uint32":     4,
+	"rune":       4,
+	"float32":    4,
+	"int64":      8,
+	"uint64":     8,
+	"float64":    8,
+	"complex64":  8,
+	"complex128": 16,
+}
+
+// TypeMap maps C types to conversions. Exact entries take precedence over
+// pattern entries; among pattern entries, the last one matching wins, so
+// later entries override earlier ones in both cases. Qualifiers are ignored:
+// exact entries are keyed by, and patterns match, CType.Key. Patterns only
+// match types without pointers or dimensions, so pointers to a type matched
+// by a pattern are derived from its mapping like those of exact entries.
+type TypeMap struct {
+	exact    map[string]TypeConv
+	patterns []typePattern
+	// enumNames maps the bases of enum types, e.g. "enum nk_heading", to the
+	// names of the Go types generated for them where they are renamed, so
+	// that automatic conversions use the same names.
+	enumNames map[string]string
+}
+
+// typePattern is a typemap entry whose C type is a regexp or glob. Captures
+// are substituted into the Go type as exported names and into the cgo type
+// verbatim.
+type typePattern struct {
+	regexp *regexp.Regexp
+	conv   TypeConv
 }
 
-func parseTypeMap(fileName string) (map[string]TypeConv, error) {
+const typeRegexpPrefix = "regexp:"
+
+func newTypeMap() *TypeMap {
+	return &TypeMap{exact: make(map[string]TypeConv)}
+}
+
+// withEnumNames returns a copy of the typemap which converts the enum types
+// whose bases are keys of names to the Go types named by their values.
+func (typeMap *TypeMap) withEnumNames(names map[string]string) *TypeMap {
+	renamed := *typeMap
+	renamed.enumNames = names
+	return &renamed
+}
+
+// add adds a mapping for cType, which is either an exact C type, a regexp
+// prefixed with regexp: or a shell glob prefixed with glob:.
+func (typeMap *TypeMap) add(cType string, conv TypeConv) error {
+	var re *regexp.Regexp
+	var err error
+	if strings.HasPrefix(cType, typeRegexpPrefix) {
+		re, err = regexp.Compile("^(?:" + strings.TrimPrefix(cType, typeRegexpPrefix) + ")$")
+	} else if strings.HasPrefix(cType, globPrefix) {
+		re, err = compileGlob(strings.TrimPrefix(cType, globPrefix))
+	} else {
+		t, err := parseCType(cType)
+		if err != nil {
+			return err
+		}
+		typeMap.exact[t.Key()] = conv
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("compiling C type pattern: %w", err)
+	}
+	typeMap.patterns = append(typeMap.patterns, typePattern{regexp: re, conv: conv})
+	return nil
+}
+
+// lookup returns the mapping for t, if any.
+func (typeMap *TypeMap) lookup(t CType) (TypeConv, bool) {
+	key := t.Key()
+	if conv, ok := typeMap.exact[key]; ok {
+		return conv, true
+	}
+	if len(t.Pointers) != 0 || len(t.Dims) != 0 {
+		return TypeConv{}, false
+	}
+	for i := len(typeMap.patterns) - 1; i >= 0; i-- {
+		pattern := typeMap.patterns[i]
+		captures := pattern.regexp.FindStringSubmatch(key)
+		if captures == nil {
+			continue
+		}
+		names := pattern.regexp.SubexpNames()
+		expand := func(template string, transform func(string) string) string {
+			return os.Expand(template, func(key string) string {
+				for j, name := range names {
+					if j > 0 && (name == key || strconv.Itoa(j) == key) {
+						return transform(captures[j])
+					}
+				}
+				// e.g. sizedIntType
+				return "$" + key
+			})
+		}
+		return TypeConv{
+			GoType:  expand(pattern.conv.GoType, exportedName),
+			CgoType: expand(pattern.conv.CgoType, func(s string) string { return s }),
+			Options: pattern.conv.Options,
+		}, true
+	}
+	return TypeConv{}, false
+}
+
+// loadTypeMap returns the mappings from the file of src, if any, overridden
+// by its inline mappings.
+func loadTypeMap(src TypeMapSource) (*TypeMap, error) {
+	typeMap := newTypeMap()
+	if src.File != "" {
+		if err := parseTypeMap(src.File, typeMap); err != nil {
+			return nil, fmt.Errorf("parsing file '%s': %w", src.File, err)
+		}
+	}
+	for i, entry := range src.Types {
+		options, err := parseTypeOptions(entry.Options)
+		if err != nil {
+			return nil, fmt.Errorf("inline mapping %d: %w", i, err)
+		}
+		conv := TypeConv{
+			GoType:  entry.GoType,
+			CgoType: entry.CgoType,
+			Options: options,
+		}
+		if err := typeMap.add(entry.CType, conv); err != nil {
+			return nil, fmt.Errorf("inline mapping %d: %w", i, err)
+		}
+	}
+	return typeMap, nil
+}
+
+// parseTypeMap adds the mappings in the named file to typeMap.
+func parseTypeMap(fileName string, typeMap *TypeMap) error {
 	file, err := os.Open(fileName)
 	if err != nil {
-		return nil, fmt.Errorf("opening file: %w", err)
+		return fmt.Errorf("opening file: %w", err)
 	}
 	defer file.Close()
-	typeMap := make(map[string]TypeConv)
 	reader := csv.NewReader(file)
 	reader.Comment = '#'
 	reader.TrimLeadingSpace = true
-	reader.FieldsPerRecord = 3
+	reader.FieldsPerRecord = -1
 	reader.ReuseRecord = true
 	for {
 		record, err := reader.Read()
 		if err != nil && err != io.EOF {
-			return nil, fmt.Errorf("CSV read error: %w", err)
+			return fmt.Errorf("CSV read error: %w", err)
 		} else if len(record) == 0 {
 			break
 		}
-		typeMap[record[0]] = TypeConv{
+		line, _ := reader.FieldPos(0)
+		if len(record) < 3 || len(record) > 4 {
+			return fmt.Errorf("line %d: expected 3 or 4 fields, got %d", line, len(record))
+		}
+		var options TypeOptions
+		if len(record) == 4 {
+			if options, err = parseTypeOptions(record[3]); err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		conv := TypeConv{
 			GoType:  record[1],
 			CgoType: record[2],
+			Options: options,
+		}
+		if err := typeMap.add(record[0], conv); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
 		}
 	}
-	return typeMap, nil
+	return nil
 }
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTypeMapPatterns(t *testing.T) {
+	typeMap := newTypeMap()
+	entries := []struct {
+		cType string
+		conv  TypeConv
+	}{
+		{"regexp:struct nk_style_(.*)", TypeConv{GoType: "Style$1", CgoType: "C.struct_nk_style_$1"}},
+		{"glob:enum nk_*_flags", TypeConv{GoType: "${1}Flags", CgoType: "C.enum_nk_${1}_flags"}},
+		{"glob:nk_*_t", TypeConv{GoType: "$int", CgoType: "C.nk_${1}_t"}},
+		{"struct nk_style_window", TypeConv{GoType: "WindowStyle", CgoType: "C.struct_nk_style_window"}},
+	}
+	for _, entry := range entries {
+		if err := typeMap.add(entry.cType, entry.conv); err != nil {
+			t.Fatalf("adding %s: %v", entry.cType, err)
+		}
+	}
+	tests := []struct {
+		cType   string
+		goType  string
+		cgoType string
+		err     bool
+	}{
+		{"struct nk_style_button", "StyleButton", "C.struct_nk_style_button", false},
+		{"struct nk_style_button *", "*StyleButton", "*C.struct_nk_style_button", false},
+		{"const struct nk_style_button *", "*StyleButton", "*C.struct_nk_style_button", false},
+		{"struct nk_style_button **", "**StyleButton", "**C.struct_nk_style_button", false},
+		{"struct nk_style_window *", "*WindowStyle", "*C.struct_nk_style_window", false},
+		{"enum nk_panel_flags", "PanelFlags", "C.enum_nk_panel_flags", false},
+		{"enum nk_panel_flags *", "*PanelFlags", "*C.enum_nk_panel_flags", false},
+		// not matched by the pattern, so mapped conventionally
+		{"struct nk_style", "Style", "C.struct_nk_style", false},
+		// the size of the C type is unknown when parsed from a string
+		{"nk_foo_t", "", "", true},
+	}
+	for _, test := range tests {
+		cType, err := parseCType(test.cType)
+		if err != nil {
+			t.Fatalf("parsing %s: %v", test.cType, err)
+		}
+		conv, err := convertType(typeMap, cType, ConvertTypeDefault)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error, got Go type '%s'", test.cType, conv.GoType)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: %v", test.cType, err)
+			continue
+		}
+		if conv.GoType != test.goType || conv.CgoType != test.cgoType {
+			t.Errorf("%s: got Go type '%s' and cgo type '%s', want '%s' and '%s'", test.cType, conv.GoType,
+				conv.CgoType, test.goType, test.cgoType)
+		}
+	}
+}
+
+func TestParseTypeMapOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		cType   string
+		goType  string
+		options TypeOptions
+		err     bool
+	}{
+		{"no options", "int,int32,C.int\n", "int", "int32", 0, false},
+		{"empty options", "int,int32,C.int,\n", "int", "int32", 0, false},
+		{"one option", "size_t,uintptr,C.size_t,unsafeptr\n", "size_t", "uintptr", TypeUnsafePtr, false},
+		{"several options", "struct nk_color,Color,C.struct_nk_color,byvalue nilable\n", "struct nk_color",
+			"Color", TypeByValue | TypeNilable, false},
+		{"inherited by pointers", "size_t,uintptr,C.size_t,unsafeptr\n", "size_t *", "*uintptr", TypeUnsafePtr,
+			false},
+		{"by value pointer", "struct nk_color,Color,C.struct_nk_color,byvalue\n", "struct nk_color *", "Color",
+			TypeByValue, false},
+		{"unknown option", "int,int32,C.int,fast\n", "", "", 0, true},
+		{"too many fields", "int,int32,C.int,unsafeptr,nilable\n", "", "", 0, true},
+		{"too few fields", "int,int32\n", "", "", 0, true},
+	}
+	for _, test := range tests {
+		fileName := filepath.Join(t.TempDir(), "typemap.csv")
+		if err := os.WriteFile(fileName, []byte(test.csv), 0o666); err != nil {
+			t.Fatal(err)
+		}
+		typeMap := newTypeMap()
+		err := parseTypeMap(fileName, typeMap)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		cType, err := parseCType(test.cType)
+		if err != nil {
+			t.Fatalf("%s: parsing %s: %v", test.name, test.cType, err)
+		}
+		conv, err := convertType(typeMap, cType, ConvertTypeDefault)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if conv.GoType != test.goType || conv.Options != test.options {
+			t.Errorf("%s: got Go type '%s' with options '%s', want '%s' with '%s'", test.name, conv.GoType,
+				conv.Options, test.goType, test.options)
+		}
+	}
+}
@@ -3,91 +3,202 @@ package main
 import (
 	"errors"
 	"fmt"
+	"reflect"
+	"sort"
 	"strings"
 
 	"modernc.org/cc/v3"
 )
 
-func makeFuncParams(paramList *cc.ParameterList) ([]FunctionParam, error) {
-	var params []FunctionParam
-	// parameter_list
-	//   : parameter_declaration
-	//   | parameter_list ',' parameter_declaration
-	//   ;
-	for pl, i := paramList, 0; pl != nil; pl, i = pl.ParameterList, i+1 {
-		// parameter_declaration
-		//   : declaration_specifiers declarator
-		//   | declaration_specifiers abstract_declarator
-		//   | declaration_specifiers
-		//   ;
-		pd := pl.ParameterDeclaration
-		var paramType strings.Builder
-		var name string
-		if err := writeDeclSpec(&paramType, pd.DeclarationSpecifiers); err != nil {
-			return nil, fmt.Errorf("computing declaration_specifier for parameter %d: %w", i, err)
+// Qualifiers is a set of C type qualifiers.
+type Qualifiers int32
+
+const (
+	QualConst Qualifiers = 1 << iota
+	QualRestrict
+	QualVolatile
+)
+
+var qualifierNames = []struct {
+	name string
+	qual Qualifiers
+}{
+	{"const", QualConst},
+	{"restrict", QualRestrict},
+	{"volatile", QualVolatile},
+}
+
+func (quals Qualifiers) String() string {
+	var names []string
+	for _, q := range qualifierNames {
+		if quals&q.qual != 0 {
+			names = append(names, q.name)
 		}
-		if decl := pd.Declarator; decl != nil {
-			// declarator
-			//   : pointer direct_declarator
-			//   | direct_declarator
-			//   ;
-			if ptr := decl.Pointer; ptr != nil {
-				if err := writePointer(&paramType, ptr); err != nil {
-					return nil, fmt.Errorf("computing declarator pointer for parameter %d: %w", i, err)
-				}
-			}
-			if dirDecl := decl.DirectDeclarator; dirDecl != nil {
-				// direct_declarator
-				//   : IDENTIFIER
-				//   | '(' declarator ')'
-				//   | direct_declarator '[' constant_expression ']'
-				//   | direct_declarator '[' ']'
-				//   | direct_declarator '(' parameter_type_list ')'
-				//   | direct_declarator '(' identifier_list ')'
-				//   | direct_declarator '(' ')'
-				//   ;
-				switch dirDecl.Case {
-				case cc.DirectDeclaratorIdent:
-					name = dirDecl.Name().String()
-				default:
-					return nil, errors.New("nested direct_declarator found")
-				}
-			}
+	}
+	return strings.Join(names, " ")
+}
+
+// CTypeKind identifies what the base of a CType is.
+type CTypeKind int
+
+const (
+	// CTypeBasic is void or an arithmetic type.
+	CTypeBasic CTypeKind = iota
+	CTypeTypedef
+	CTypeStruct
+	CTypeUnion
+	CTypeEnum
+	// CTypeFunc is a function type, whose signature is in CType.Func.
+	CTypeFunc
+)
+
+func (kind CTypeKind) String() string {
+	switch kind {
+	case CTypeBasic:
+		return "basic"
+	case CTypeTypedef:
+		return "typedef"
+	case CTypeStruct:
+		return "struct"
+	case CTypeUnion:
+		return "union"
+	case CTypeEnum:
+		return "enum"
+	case CTypeFunc:
+		return "function"
+	}
+	return fmt.Sprintf("CTypeKind(%d)", int(kind))
+}
+
+// CType is a C type in a normalized form, so that the placement and order of
+// qualifiers and specifiers does not matter.
+type CType struct {
+	Kind CTypeKind
+	// Base is the name of the base type in canonical form, e.g. "unsigned
+	// int" for "int unsigned", or "struct nk_context"; it is empty for
+	// function types.
+	Base string
+	// Quals are the qualifiers of the base type.
+	Quals Qualifiers
+	// Pointers holds the qualifiers of each pointer level, from the one
+	// nearest the base type outwards; "char *const *" has two levels, of
+	// which the first is const.
+	Pointers []Qualifiers
+	// Dims are the array dimensions as written, with "" for an unspecified
+	// dimension; the type is an array of pointers if it has both.
+	Dims []string
+	// Func is the signature of a function type.
+	Func *CFuncType
+	// Layout is the layout of the type, and BaseLayout that of its base type
+	// without any pointers or dimensions.
+	Layout     Layout
+	BaseLayout Layout
+}
+
+// Layout describes the layout of a type on the target as computed by the type
+// checker. Size is 0 if the layout is unknown, e.g. for incomplete types or
+// types parsed from strings. Only the size is recorded, since it is all that
+// is checked; struct members and alignments are not.
+type Layout struct {
+	Size int64
+}
+
+// CFuncType is the signature of a function type.
+type CFuncType struct {
+	Return   CType
+	Params   []FunctionParam
+	Variadic bool
+}
+
+// Name returns the name of the base type without any struct, union or enum
+// keyword.
+func (t CType) Name() string {
+	if i := strings.IndexByte(t.Base, ' '); i >= 0 && t.Kind != CTypeBasic {
+		return t.Base[i+1:]
+	}
+	return t.Base
+}
+
+// String returns the type with its qualifiers in canonical form, e.g.
+// "const char *const *" or "void (*)(int, float)".
+func (t CType) String() string {
+	var declarator strings.Builder
+	for _, quals := range t.Pointers {
+		declarator.WriteRune('*')
+		if quals != 0 {
+			declarator.WriteString(quals.String())
+			declarator.WriteRune(' ')
 		}
-		if absDecl := pd.AbstractDeclarator; absDecl != nil {
-			// abstract_declarator
-			//   : pointer
-			//   | direct_abstract_declarator
-			//   | pointer direct_abstract_declarator
-			//   ;
-			if ptr := absDecl.Pointer; ptr != nil {
-				if err := writePointer(&paramType, ptr); err != nil {
-					return nil, fmt.Errorf("computing abstract_declarator pointer for parameter %d: %w", i, err)
-				}
-			}
-			if dirAbsDecl := absDecl.DirectAbstractDeclarator; dirAbsDecl != nil {
-				return nil, errors.New("direct_abstract_declarator found")
-			}
+	}
+	for _, dim := range t.Dims {
+		fmt.Fprintf(&declarator, "[%s]", dim)
+	}
+	abstract := strings.TrimSpace(declarator.String())
+	if t.Kind == CTypeFunc {
+		params := make([]string, len(t.Func.Params))
+		for i, param := range t.Func.Params {
+			params[i] = param.Type.String()
 		}
-		params = append(params, FunctionParam{
-			Name: name,
-			Type: strings.TrimSpace(paramType.String()),
-		})
+		if t.Func.Variadic {
+			params = append(params, "...")
+		} else if len(params) == 0 {
+			params = append(params, "void")
+		}
+		if abstract != "" {
+			abstract = "(" + abstract + ")"
+		}
+		return fmt.Sprintf("%s %s(%s)", t.Func.Return, abstract, strings.Join(params, ", "))
 	}
-	return params, nil
+	var s strings.Builder
+	if t.Quals != 0 {
+		s.WriteString(t.Quals.String())
+		s.WriteRune(' ')
+	}
+	s.WriteString(t.Base)
+	if abstract != "" {
+		s.WriteRune(' ')
+		s.WriteString(abstract)
+	}
+	return s.String()
 }
-func returnTypeName(declSpec *cc.DeclarationSpecifiers, pointer *cc.Pointer) (string, error) {
-	var result strings.Builder
-	if err := writeDeclSpec(&result, declSpec); err != nil {
-		return "", err
+
+// Unqualified returns the type without any qualifiers.
+func (t CType) Unqualified() CType {
+	u := t
+	u.Quals = 0
+	if len(t.Pointers) != 0 {
+		u.Pointers = make([]Qualifiers, len(t.Pointers))
 	}
-	if err := writePointer(&result, pointer); err != nil {
-		return "", err
+	return u
+}
+
+// Key returns the string form of the unqualified type, which identifies the
+// type in the typemap and receiver rules.
+func (t CType) Key() string {
+	return t.Unqualified().String()
+}
+
+// IsPointer reports whether the type is a pointer, not an array.
+func (t CType) IsPointer() bool {
+	return len(t.Pointers) != 0 && len(t.Dims) == 0
+}
+
+// Elem returns the type pointed to by a pointer type.
+func (t CType) Elem() CType {
+	elem := t
+	elem.Pointers = t.Pointers[:len(t.Pointers)-1]
+	if len(elem.Pointers) == 0 {
+		elem.Pointers = nil
+	}
+	if len(elem.Pointers) == 0 && len(elem.Dims) == 0 {
+		elem.Layout = t.BaseLayout
 	}
-	return strings.TrimSpace(result.String()), nil
+	return elem
 }
 
-func writeDeclSpec(dst *strings.Builder, declSpec *cc.DeclarationSpecifiers) error {
+// cTypeOfSpecifiers returns the base type and qualifiers given by the
+// declaration specifiers of a declaration.
+func cTypeOfSpecifiers(declSpec *cc.DeclarationSpecifiers) (CType, error) {
 	// declaration_specifiers
 	//   : storage_class_specifier
 	//   | storage_class_specifier declaration_specifiers
@@ -96,61 +207,46 @@ func writeDeclSpec(dst *strings.Builder, declSpec *cc.DeclarationSpecifiers) err
 	//   | type_qualifier
 	//   | type_qualifier declaration_specifiers
 	//   ;
+	var t CType
+	var words []string
 	for ds := declSpec; ds != nil; ds = ds.DeclarationSpecifiers {
 		// ignore storage_class_specifier
 		if ts := ds.TypeSpecifier; ts != nil {
-			if err := writeTypeSpec(dst, ts); err != nil {
-				return err
+			kind, word, err := typeSpecWord(ts)
+			if err != nil {
+				return CType{}, err
 			}
+			if kind != CTypeBasic {
+				t.Kind = kind
+			}
+			words = append(words, word)
 		}
 		if tq := ds.TypeQualifier; tq != nil {
-			if err := writeTypeQual(dst, tq); err != nil {
-				return err
+			qual, err := typeQual(tq)
+			if err != nil {
+				return CType{}, err
 			}
+			t.Quals |= qual
 		}
 	}
-	return nil
-
-}
-
-func writePointer(dst *strings.Builder, pointer *cc.Pointer) error {
-	// pointer
-	//   : '*'
-	//   | '*' type_qualifier_list
-	//   | '*' pointer
-	//   | '*' type_qualifier_list pointer
-	//   ;
-	for p := pointer; p != nil; p = p.Pointer {
-		dst.WriteRune('*')
-		if tql := p.TypeQualifiers; tql != nil {
-			if err := writeTypeQualList(dst, tql); err != nil {
-				return err
-			}
+	if t.Kind != CTypeBasic {
+		if len(words) != 1 {
+			return CType{}, fmt.Errorf("'%s' cannot be combined with other type specifiers", words[0])
 		}
+		t.Base = words[0]
+		return t, nil
 	}
-	return nil
-}
-
-func writeTypeQual(dst *strings.Builder, typeQual *cc.TypeQualifier) error {
-	// type_qualifier
-	//   : CONST
-	//   | RESTRICT
-	//   | VOLATILE
-	//   ;
-	switch typeQual.Case {
-	case cc.TypeQualifierConst:
-		dst.WriteString("const ")
-	case cc.TypeQualifierRestrict:
-		dst.WriteString("restrict ")
-	case cc.TypeQualifierVolatile:
-		dst.WriteString("volatile ")
-	default:
-		return fmt.Errorf("unhandled type_qualifier case %s", typeQual.Case)
+	base, err := canonicalBase(words)
+	if err != nil {
+		return CType{}, err
 	}
-	return nil
+	t.Base = base
+	return t, nil
 }
 
-func writeTypeSpec(dst *strings.Builder, typeSpec *cc.TypeSpecifier) error {
+// typeSpecWord returns the kind and the name of a type specifier, which is a
+// single keyword for basic types.
+func typeSpecWord(typeSpec *cc.TypeSpecifier) (CTypeKind, string, error) {
 	// type_specifier
 	//   : VOID
 	//   | CHAR
@@ -170,27 +266,27 @@ func writeTypeSpec(dst *strings.Builder, typeSpec *cc.TypeSpecifier) error {
 	// ;
 	switch typeSpec.Case {
 	case cc.TypeSpecifierVoid:
-		dst.WriteString("void ")
+		return CTypeBasic, "void", nil
 	case cc.TypeSpecifierChar:
-		dst.WriteString("char ")
+		return CTypeBasic, "char", nil
 	case cc.TypeSpecifierShort:
-		dst.WriteString("short ")
+		return CTypeBasic, "short", nil
 	case cc.TypeSpecifierInt:
-		dst.WriteString("int ")
+		return CTypeBasic, "int", nil
 	case cc.TypeSpecifierLong:
-		dst.WriteString("long ")
+		return CTypeBasic, "long", nil
 	case cc.TypeSpecifierFloat:
-		dst.WriteString("float ")
+		return CTypeBasic, "float", nil
 	case cc.TypeSpecifierDouble:
-		dst.WriteString("double ")
+		return CTypeBasic, "double", nil
 	case cc.TypeSpecifierSigned:
-		dst.WriteString("signed ")
+		return CTypeBasic, "signed", nil
 	case cc.TypeSpecifierUnsigned:
-		dst.WriteString("unsigned ")
+		return CTypeBasic, "unsigned", nil
 	case cc.TypeSpecifierBool:
-		dst.WriteString("bool ")
+		return CTypeBasic, "bool", nil
 	case cc.TypeSpecifierComplex:
-		dst.WriteString("complex ")
+		return CTypeBasic, "complex", nil
 	case cc.TypeSpecifierStructOrUnion:
 		// struct_or_union_specifier
 		//   : struct_or_union IDENTIFIER '{' struct_declaration_list '}'
@@ -199,21 +295,18 @@ func writeTypeSpec(dst *strings.Builder, typeSpec *cc.TypeSpecifier) error {
 		//   ;
 		sus := typeSpec.StructOrUnionSpecifier
 		if sus.AttributeSpecifierList != nil {
-			return errors.New("unhandled attribute_specifier_list on struct_or_union_specifier")
+			return 0, "", errors.New("unhandled attribute_specifier_list on struct_or_union_specifier")
 		} else if sus.StructDeclarationList != nil {
-			return errors.New("unhandled struct_declaration_list on struct_or_union_specifier")
+			return 0, "", errors.New("unhandled struct_declaration_list on struct_or_union_specifier")
 		}
 		switch sus.StructOrUnion.Case {
 		case cc.StructOrUnionStruct:
-			dst.WriteString("struct ")
+			return CTypeStruct, "struct " + sus.Token.String(), nil
 		case cc.StructOrUnionUnion:
-			dst.WriteString("union ")
+			return CTypeUnion, "union " + sus.Token.String(), nil
 		default:
-			return fmt.Errorf("unhandled struct_or_union case %s", sus.StructOrUnion.Case)
+			return 0, "", fmt.Errorf("unhandled struct_or_union case %s", sus.StructOrUnion.Case)
 		}
-		dst.WriteString(sus.Token.String())
-		dst.WriteRune(' ')
-		// TODO what to do with token2 and token3?
 	case cc.TypeSpecifierEnum:
 		// enum_specifier
 		//   : ENUM '{' enumerator_list '}'
@@ -224,30 +317,458 @@ func writeTypeSpec(dst *strings.Builder, typeSpec *cc.TypeSpecifier) error {
 		//   ;
 		es := typeSpec.EnumSpecifier
 		if es.AttributeSpecifierList != nil {
-			return errors.New("unhandled attribute_specifier_list on enum_specifier")
+			return 0, "", errors.New("unhandled attribute_specifier_list on enum_specifier")
 		} else if es.EnumeratorList != nil {
-			return errors.New("unhandled enumerator_list on enum_specifier")
+			return 0, "", errors.New("unhandled enumerator_list on enum_specifier")
 		}
-		dst.WriteString("enum ")
-		dst.WriteString(es.Token2.String())
-		// TODO what to do with other tokens?
+		return CTypeEnum, "enum " + es.Token2.String(), nil
 	case cc.TypeSpecifierTypedefName:
-		dst.WriteString(typeSpec.Token.String())
-	default:
-		return fmt.Errorf("unhandled type_specifier case %s", typeSpec.Case)
+		return CTypeTypedef, typeSpec.Token.String(), nil
 	}
-	return nil
+	return 0, "", fmt.Errorf("unhandled type_specifier case %s", typeSpec.Case)
 }
 
-func writeTypeQualList(dst *strings.Builder, typeQualList *cc.TypeQualifiers) error {
+func typeQual(typeQual *cc.TypeQualifier) (Qualifiers, error) {
+	// type_qualifier
+	//   : CONST
+	//   | RESTRICT
+	//   | VOLATILE
+	//   ;
+	switch typeQual.Case {
+	case cc.TypeQualifierConst:
+		return QualConst, nil
+	case cc.TypeQualifierRestrict:
+		return QualRestrict, nil
+	case cc.TypeQualifierVolatile:
+		return QualVolatile, nil
+	}
+	return 0, fmt.Errorf("unhandled type_qualifier case %s", typeQual.Case)
+}
+
+func typeQualList(typeQualList *cc.TypeQualifiers) (Qualifiers, error) {
 	// type_qualifier_list
 	//   : type_qualifier
 	//   | type_qualifier_list type_qualifier
 	//   ;
+	var quals Qualifiers
 	for tql := typeQualList; tql != nil; tql = tql.TypeQualifiers {
-		if err := writeTypeQual(dst, tql.TypeQualifier); err != nil {
-			return err
+		qual, err := typeQual(tql.TypeQualifier)
+		if err != nil {
+			return 0, err
 		}
+		quals |= qual
+	}
+	return quals, nil
+}
+
+// pointerTo applies the pointer part of a declarator to t.
+func pointerTo(t CType, pointer *cc.Pointer) (CType, error) {
+	// pointer
+	//   : '*'
+	//   | '*' type_qualifier_list
+	//   | '*' pointer
+	//   | '*' type_qualifier_list pointer
+	//   ;
+	if pointer != nil && len(t.Dims) != 0 {
+		return CType{}, errors.New("pointers to arrays are not supported")
+	}
+	for p := pointer; p != nil; p = p.Pointer {
+		quals, err := typeQualList(p.TypeQualifiers)
+		if err != nil {
+			return CType{}, err
+		}
+		t.Pointers = append(t.Pointers, quals)
+	}
+	return t, nil
+}
+
+// arrayOf returns an array of t with the dimension given by expr, which is
+// nil for an unspecified dimension.
+func arrayOf(t CType, expr *cc.AssignmentExpression) (CType, error) {
+	if t.Kind == CTypeFunc && len(t.Pointers) == 0 {
+		return CType{}, errors.New("arrays of functions are not allowed")
+	}
+	dim := ""
+	if expr != nil {
+		dim = nodeText(expr)
+	}
+	// suffixes are applied from the outermost, which is the last dimension
+	t.Dims = append([]string{dim}, t.Dims...)
+	return t, nil
+}
+
+// funcOf returns a function type returning t with the given parameters.
+func funcOf(t CType, paramTypeList *cc.ParameterTypeList) (CType, error) {
+	if t.Kind == CTypeFunc && len(t.Pointers) == 0 || len(t.Dims) != 0 {
+		return CType{}, errors.New("functions returning functions or arrays are not allowed")
+	}
+	sig := &CFuncType{Return: t}
+	if paramTypeList != nil {
+		// parameter_type_list
+		//   : parameter_list
+		//   | parameter_list ',' ELLIPSIS
+		//   ;
+		params, err := makeFuncParams(paramTypeList.ParameterList)
+		if err != nil {
+			return CType{}, err
+		}
+		sig.Params = params
+		sig.Variadic = paramTypeList.Case == cc.ParameterTypeListVar
+	}
+	return CType{Kind: CTypeFunc, Func: sig}, nil
+}
+
+// declaratorType applies a declarator to the base type t, returning the
+// declared type and name.
+func declaratorType(t CType, decl *cc.Declarator) (CType, string, error) {
+	// declarator
+	//   : pointer direct_declarator
+	//   | direct_declarator
+	//   ;
+	t, err := pointerTo(t, decl.Pointer)
+	if err != nil {
+		return CType{}, "", err
+	}
+	// direct_declarator
+	//   : IDENTIFIER
+	//   | '(' declarator ')'
+	//   | direct_declarator '[' constant_expression ']'
+	//   | direct_declarator '[' ']'
+	//   | direct_declarator '(' parameter_type_list ')'
+	//   | direct_declarator '(' identifier_list ')'
+	//   | direct_declarator '(' ')'
+	//   ;
+	for dd := decl.DirectDeclarator; ; dd = dd.DirectDeclarator {
+		switch dd.Case {
+		case cc.DirectDeclaratorIdent:
+			return t, dd.Token.String(), nil
+		case cc.DirectDeclaratorDecl:
+			return declaratorType(t, dd.Declarator)
+		case cc.DirectDeclaratorArr, cc.DirectDeclaratorStaticArr, cc.DirectDeclaratorArrStatic,
+			cc.DirectDeclaratorStar:
+			t, err = arrayOf(t, dd.AssignmentExpression)
+		case cc.DirectDeclaratorFuncParam:
+			t, err = funcOf(t, dd.ParameterTypeList)
+		case cc.DirectDeclaratorFuncIdent:
+			if dd.IdentifierList != nil {
+				return CType{}, "", errors.New("identifier lists are not supported")
+			}
+			t, err = funcOf(t, nil)
+		default:
+			return CType{}, "", fmt.Errorf("unhandled direct_declarator case %s", dd.Case)
+		}
+		if err != nil {
+			return CType{}, "", err
+		}
+	}
+}
+
+// abstractDeclaratorType applies an abstract declarator to the base type t.
+func abstractDeclaratorType(t CType, absDecl *cc.AbstractDeclarator) (CType, error) {
+	// abstract_declarator
+	//   : pointer
+	//   | direct_abstract_declarator
+	//   | pointer direct_abstract_declarator
+	//   ;
+	t, err := pointerTo(t, absDecl.Pointer)
+	if err != nil {
+		return CType{}, err
+	}
+	// direct_abstract_declarator
+	//   : '(' abstract_declarator ')'
+	//   | '[' ']'
+	//   | '[' constant_expression ']'
+	//   | direct_abstract_declarator '[' ']'
+	//   | direct_abstract_declarator '[' constant_expression ']'
+	//   | '(' ')'
+	//   | '(' parameter_type_list ')'
+	//   | direct_abstract_declarator '(' ')'
+	//   | direct_abstract_declarator '(' parameter_type_list ')'
+	//   ;
+	for dad := absDecl.DirectAbstractDeclarator; dad != nil; dad = dad.DirectAbstractDeclarator {
+		switch dad.Case {
+		case cc.DirectAbstractDeclaratorDecl:
+			return abstractDeclaratorType(t, dad.AbstractDeclarator)
+		case cc.DirectAbstractDeclaratorArr, cc.DirectAbstractDeclaratorStaticArr,
+			cc.DirectAbstractDeclaratorArrStatic, cc.DirectAbstractDeclaratorArrStar:
+			t, err = arrayOf(t, dad.AssignmentExpression)
+		case cc.DirectAbstractDeclaratorFunc:
+			t, err = funcOf(t, dad.ParameterTypeList)
+		default:
+			return CType{}, fmt.Errorf("unhandled direct_abstract_declarator case %s", dad.Case)
+		}
+		if err != nil {
+			return CType{}, err
+		}
+	}
+	return t, nil
+}
+
+func makeFuncParams(paramList *cc.ParameterList) ([]FunctionParam, error) {
+	var params []FunctionParam
+	// parameter_list
+	//   : parameter_declaration
+	//   | parameter_list ',' parameter_declaration
+	//   ;
+	for pl, i := paramList, 0; pl != nil; pl, i = pl.ParameterList, i+1 {
+		// parameter_declaration
+		//   : declaration_specifiers declarator
+		//   | declaration_specifiers abstract_declarator
+		//   | declaration_specifiers
+		//   ;
+		pd := pl.ParameterDeclaration
+		paramType, err := cTypeOfSpecifiers(pd.DeclarationSpecifiers)
+		if err != nil {
+			return nil, fmt.Errorf("computing declaration_specifier for parameter %d: %w", i, err)
+		}
+		var name string
+		if decl := pd.Declarator; decl != nil {
+			if paramType, name, err = declaratorType(paramType, decl); err != nil {
+				return nil, fmt.Errorf("computing declarator for parameter %d: %w", i, err)
+			}
+		}
+		if absDecl := pd.AbstractDeclarator; absDecl != nil {
+			if paramType, err = abstractDeclaratorType(paramType, absDecl); err != nil {
+				return nil, fmt.Errorf("computing abstract_declarator for parameter %d: %w", i, err)
+			}
+		}
+		params = append(params, FunctionParam{
+			Name: name,
+			Type: paramType,
+		})
+	}
+	// a single unnamed void parameter means there are no parameters
+	if len(params) == 1 && params[0].Name == "" && params[0].Type.Key() == "void" {
+		params = nil
+	}
+	return params, nil
+}
+
+// setLayout records the layout of t from ccType, which is the type checker's
+// view of it; for function types, it records the layouts of the return and
+// parameter types instead.
+func setLayout(t *CType, ccType cc.Type) {
+	if ccType == nil {
+		return
+	} else if t.Kind == CTypeFunc && len(t.Pointers) == 0 && ccType.Kind() == cc.Function {
+		setLayout(&t.Func.Return, ccType.Result())
+		ccParams := ccType.Parameters()
+		if len(ccParams) != len(t.Func.Params) {
+			return
+		}
+		for i := range t.Func.Params {
+			setLayout(&t.Func.Params[i].Type, ccParams[i].Type())
+		}
+		return
+	}
+	t.Layout = layoutOf(ccType)
+	if len(t.Pointers) == 0 && len(t.Dims) == 0 {
+		t.BaseLayout = t.Layout
+		return
+	}
+	base := ccType
+	for i := 0; i < len(t.Dims)+len(t.Pointers); i++ {
+		if kind := base.Kind(); kind != cc.Ptr && kind != cc.Array {
+			// e.g. a typedef for a pointer type
+			return
+		}
+		base = base.Elem()
+	}
+	t.BaseLayout = layoutOf(base)
+}
+
+func layoutOf(ccType cc.Type) Layout {
+	if ccType.Kind() == cc.Void || ccType.Kind() == cc.Function || ccType.IsIncomplete() {
+		return Layout{}
+	}
+	return Layout{
+		Size: int64(ccType.Size()),
+	}
+}
+
+// nodeText returns the source text of an AST node, with its tokens separated
+// by single spaces.
+func nodeText(node cc.Node) string {
+	var tokens []cc.Token
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.Ptr:
+			if !v.IsNil() {
+				walk(v.Elem())
+			}
+		case reflect.Struct:
+			if token, ok := v.Interface().(cc.Token); ok {
+				if token.Rune != 0 {
+					tokens = append(tokens, token)
+				}
+				return
+			}
+			for i := 0; i < v.NumField(); i++ {
+				if v.Type().Field(i).PkgPath == "" {
+					walk(v.Field(i))
+				}
+			}
+		}
+	}
+	walk(reflect.ValueOf(node))
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Seq() < tokens[j].Seq()
+	})
+	words := make([]string, len(tokens))
+	for i, token := range tokens {
+		words[i] = token.String()
+	}
+	return strings.Join(words, " ")
+}
+
+// parseCType parses the string form of a C type, as written in the typemap
+// and receiver rules. Function types are not supported.
+func parseCType(s string) (CType, error) {
+	var t CType
+	var words []string
+	tokens := tokenizeCType(s)
+	i := 0
+	// qualifiers and specifiers of the base type
+	for ; i < len(tokens) && tokens[i] != "*" && tokens[i] != "["; i++ {
+		if qual, ok := parseQualifier(tokens[i]); ok {
+			t.Quals |= qual
+		} else if tokens[i] == "struct" || tokens[i] == "union" || tokens[i] == "enum" {
+			if i+1 >= len(tokens) || !identRegexp.MatchString(tokens[i+1]) {
+				return CType{}, fmt.Errorf("missing tag after %s in C type '%s'", tokens[i], s)
+			}
+			switch tokens[i] {
+			case "struct":
+				t.Kind = CTypeStruct
+			case "union":
+				t.Kind = CTypeUnion
+			case "enum":
+				t.Kind = CTypeEnum
+			}
+			words = append(words, tokens[i]+" "+tokens[i+1])
+			i++
+		} else if identRegexp.MatchString(tokens[i]) {
+			words = append(words, tokens[i])
+		} else {
+			return CType{}, fmt.Errorf("unexpected '%s' in C type '%s'", tokens[i], s)
+		}
+	}
+	base, err := canonicalBase(words)
+	if err != nil {
+		return CType{}, fmt.Errorf("C type '%s': %w", s, err)
+	}
+	t.Base = base
+	if t.Kind == CTypeBasic && len(words) == 1 && !isBasicTypeWord(words[0]) {
+		t.Kind = CTypeTypedef
+	}
+	// pointers, each followed by its qualifiers
+	for ; i < len(tokens) && tokens[i] == "*"; i++ {
+		var quals Qualifiers
+		for i+1 < len(tokens) {
+			qual, ok := parseQualifier(tokens[i+1])
+			if !ok {
+				break
+			}
+			quals |= qual
+			i++
+		}
+		t.Pointers = append(t.Pointers, quals)
+	}
+	// array dimensions
+	for ; i < len(tokens) && tokens[i] == "["; i++ {
+		var dim []string
+		for i++; i < len(tokens) && tokens[i] != "]"; i++ {
+			dim = append(dim, tokens[i])
+		}
+		if i >= len(tokens) {
+			return CType{}, fmt.Errorf("unterminated array dimension in C type '%s'", s)
+		}
+		t.Dims = append(t.Dims, strings.Join(dim, " "))
+	}
+	if i < len(tokens) {
+		return CType{}, fmt.Errorf("unexpected '%s' in C type '%s'", tokens[i], s)
+	}
+	return t, nil
+}
+
+// tokenizeCType splits a C type into words and punctuation.
+func tokenizeCType(s string) []string {
+	var tokens []string
+	start := -1
+	for i, c := range s {
+		isWord := c == '_' || '0' <= c && c <= '9' || 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z'
+		if isWord && start < 0 {
+			start = i
+		} else if !isWord && start >= 0 {
+			tokens = append(tokens, s[start:i])
+			start = -1
+		}
+		if !isWord && c != ' ' && c != '\t' {
+			tokens = append(tokens, string(c))
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, s[start:])
+	}
+	return tokens
+}
+
+func parseQualifier(word string) (Qualifiers, bool) {
+	for _, q := range qualifierNames {
+		if q.name == word {
+			return q.qual, true
+		}
+	}
+	return 0, false
+}
+
+func isBasicTypeWord(word string) bool {
+	switch word {
+	case "signed", "unsigned", "short", "long", "char", "int", "float", "double", "void", "bool", "complex":
+		return true
+	}
+	return false
+}
+
+// canonicalBase combines the specifiers of a base type in canonical order,
+// e.g. "long unsigned int" becomes "unsigned long".
+func canonicalBase(words []string) (string, error) {
+	if len(words) == 0 {
+		return "", errors.New("missing base type")
+	} else if len(words) == 1 && words[0] != "signed" && words[0] != "unsigned" {
+		return words[0], nil
+	}
+	counts := make(map[string]int)
+	for _, word := range words {
+		if !isBasicTypeWord(word) {
+			return "", fmt.Errorf("'%s' cannot be combined with other type specifiers", word)
+		}
+		counts[word]++
+	}
+	if counts["signed"]+counts["unsigned"] > 1 || counts["short"] > 1 || counts["long"] > 2 ||
+		counts["short"] != 0 && counts["long"] != 0 {
+		return "", fmt.Errorf("invalid combination of type specifiers '%s'", strings.Join(words, " "))
+	}
+	var canonical []string
+	if counts["unsigned"] != 0 {
+		canonical = append(canonical, "unsigned")
+	} else if counts["signed"] != 0 && counts["char"] != 0 {
+		// plain char and signed char are distinct types
+		canonical = append(canonical, "signed")
+	}
+	for _, word := range []string{"short", "long", "long"} {
+		if counts[word] != 0 {
+			canonical = append(canonical, word)
+			counts[word]--
+		}
+	}
+	for _, word := range []string{"char", "float", "double", "void", "bool", "complex"} {
+		if counts[word] != 0 {
+			canonical = append(canonical, word)
+		}
+	}
+	if len(canonical) == 0 || len(canonical) == 1 && canonical[0] == "unsigned" {
+		canonical = append(canonical, "int")
 	}
-	return nil
+	return strings.Join(canonical, " "), nil
 }
@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+func TestParseCType(t *testing.T) {
+	tests := []struct {
+		s    string
+		str  string
+		key  string
+		kind CTypeKind
+		err  bool
+	}{
+		{"int", "int", "int", CTypeBasic, false},
+		{"long unsigned int", "unsigned long", "unsigned long", CTypeBasic, false},
+		{"int long long", "long long", "long long", CTypeBasic, false},
+		{"unsigned", "unsigned int", "unsigned int", CTypeBasic, false},
+		{"signed char", "signed char", "signed char", CTypeBasic, false},
+		{"signed int", "int", "int", CTypeBasic, false},
+		{"char const *", "const char *", "char *", CTypeBasic, false},
+		{"const char *const *", "const char *const *", "char **", CTypeBasic, false},
+		{"struct nk_context*", "struct nk_context *", "struct nk_context *", CTypeStruct, false},
+		{"const struct nk_rect", "const struct nk_rect", "struct nk_rect", CTypeStruct, false},
+		{"enum nk_heading", "enum nk_heading", "enum nk_heading", CTypeEnum, false},
+		{"union nk_handle", "union nk_handle", "union nk_handle", CTypeUnion, false},
+		{"nk_flags", "nk_flags", "nk_flags", CTypeTypedef, false},
+		{"volatile nk_uint * restrict", "volatile nk_uint *restrict", "nk_uint *", CTypeTypedef, false},
+		{"float [4]", "float [4]", "float [4]", CTypeBasic, false},
+		{"", "", "", 0, true},
+		{"struct", "", "", 0, true},
+		{"short long", "", "", 0, true},
+		{"signed unsigned int", "", "", 0, true},
+		{"nk_flags int", "", "", 0, true},
+		{"int [4", "", "", 0, true},
+		{"int * x", "", "", 0, true},
+	}
+	for _, test := range tests {
+		cType, err := parseCType(test.s)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected error, got '%s'", test.s, cType)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%q: %v", test.s, err)
+			continue
+		}
+		if str := cType.String(); str != test.str {
+			t.Errorf("%q: got string '%s', want '%s'", test.s, str, test.str)
+		}
+		if key := cType.Key(); key != test.key {
+			t.Errorf("%q: got key '%s', want '%s'", test.s, key, test.key)
+		}
+		if cType.Kind != test.kind {
+			t.Errorf("%q: got kind %s, want %s", test.s, cType.Kind, test.kind)
+		}
+	}
+}